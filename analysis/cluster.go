@@ -0,0 +1,101 @@
+// Package analysis 基于完整网格的分析：失效簇、多次测试合并、打墨、LOT 趋势及重复晶圆处理
+package analysis
+
+import (
+	"sort"
+
+	"deviceParser/model"
+)
+
+var (
+	// offsets4 上下左右四个方向
+	offsets4 = []model.Pos{{Row: -1, Col: 0}, {Row: 1, Col: 0}, {Row: 0, Col: -1}, {Row: 0, Col: 1}}
+	// offsets8 包含对角线在内的八个方向
+	offsets8 = []model.Pos{{Row: -1, Col: -1}, {Row: -1, Col: 0}, {Row: -1, Col: 1}, {Row: 0, Col: -1}, {Row: 0, Col: 1}, {Row: 1, Col: -1}, {Row: 1, Col: 0}, {Row: 1, Col: 1}}
+)
+
+// FindClusters 对满足 member 条件的 die 做连通域分析
+// connectivity 为 4 或 8，分别表示只按上下左右相连或同时按对角线相连
+func FindClusters(m model.WaferMap, member func(token string) bool, connectivity int) [][]model.Pos {
+	offsets := offsets8
+	if connectivity == 4 {
+		offsets = offsets4
+	}
+
+	visited := make([][]bool, len(m.Rows))
+	for i, row := range m.Rows {
+		visited[i] = make([]bool, len(row))
+	}
+
+	var clusters [][]model.Pos
+	for i, row := range m.Rows {
+		for j, token := range row {
+			if visited[i][j] || !member(token) {
+				continue
+			}
+
+			// 广度优先遍历当前连通域
+			visited[i][j] = true
+			cluster := []model.Pos{{Row: i, Col: j}}
+			for k := 0; k < len(cluster); k++ {
+				for _, o := range offsets {
+					next := model.Pos{Row: cluster[k].Row + o.Row, Col: cluster[k].Col + o.Col}
+					token, ok := m.At(next)
+					if !ok || visited[next.Row][next.Col] || !member(token) {
+						continue
+					}
+					visited[next.Row][next.Col] = true
+					cluster = append(cluster, next)
+				}
+			}
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
+// ClusterOptions 失效簇分析参数
+type ClusterOptions struct {
+	Connectivity   int      // 4 或 8
+	Bins           []string // 参与分析的 bin 编号，为空时使用全部失效 bin
+	GoodBins       []string // 良品 bin 编号，为空时将数值为 1 的编号视为良品
+	MaxClusters    int      // 簇数量超过该值时标记晶圆，0 表示不检查
+	MaxClusterSize int      // 最大簇超过该大小时标记晶圆，0 表示不检查
+}
+
+// AnalyzeClusters 对 map 中参与分析的失效 die 做连通域分析并汇总
+func AnalyzeClusters(m model.WaferMap, opts ClusterOptions) model.ClusterSummary {
+	binSet := make(map[string]struct{}, len(opts.Bins))
+	for _, b := range opts.Bins {
+		binSet[b] = struct{}{}
+	}
+	member := func(token string) bool {
+		if model.IsPlaceholder(token) {
+			return false
+		}
+		if len(binSet) > 0 {
+			_, ok := binSet[token]
+			return ok
+		}
+		return !model.IsGoodBin(token, opts.GoodBins)
+	}
+
+	var summary model.ClusterSummary
+	for _, cluster := range FindClusters(m, member, opts.Connectivity) {
+		box := model.ClusterBox{Size: len(cluster), MinRow: cluster[0].Row, MinCol: cluster[0].Col, MaxRow: cluster[0].Row, MaxCol: cluster[0].Col}
+		for _, p := range cluster[1:] {
+			box.MinRow = min(box.MinRow, p.Row)
+			box.MinCol = min(box.MinCol, p.Col)
+			box.MaxRow = max(box.MaxRow, p.Row)
+			box.MaxCol = max(box.MaxCol, p.Col)
+		}
+		summary.Boxes = append(summary.Boxes, box)
+		summary.Largest = max(summary.Largest, box.Size)
+	}
+	summary.Count = len(summary.Boxes)
+	sort.SliceStable(summary.Boxes, func(i, j int) bool { return summary.Boxes[i].Size > summary.Boxes[j].Size })
+
+	summary.Flagged = (opts.MaxClusters > 0 && summary.Count > opts.MaxClusters) ||
+		(opts.MaxClusterSize > 0 && summary.Largest > opts.MaxClusterSize)
+	return summary
+}
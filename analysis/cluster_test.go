@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"deviceParser/model"
+)
+
+func TestAnalyzeClusters(t *testing.T) {
+	// (0,0) 与 (1,1) 只在对角线上相邻；012 上下相邻；第 4 行 3 颗 005 横向相连
+	m := testMap("cluster.txt", grid(
+		"005 001 001 012",
+		"001 005 ... 012",
+		"___ 001 001 001",
+		"005 005 005 001",
+	))
+	box := func(size, minRow, minCol, maxRow, maxCol int) model.ClusterBox {
+		return model.ClusterBox{Size: size, MinRow: minRow, MinCol: minCol, MaxRow: maxRow, MaxCol: maxCol}
+	}
+
+	tests := []struct {
+		name string
+		opts ClusterOptions
+		want model.ClusterSummary
+	}{
+		{
+			name: "4-connectivity",
+			opts: ClusterOptions{Connectivity: 4},
+			want: model.ClusterSummary{Count: 4, Largest: 3, Boxes: []model.ClusterBox{
+				box(3, 3, 0, 3, 2), box(2, 0, 3, 1, 3), box(1, 0, 0, 0, 0), box(1, 1, 1, 1, 1),
+			}},
+		},
+		{
+			// 对角线相邻的两颗合并为一个簇
+			name: "8-connectivity",
+			opts: ClusterOptions{Connectivity: 8},
+			want: model.ClusterSummary{Count: 3, Largest: 3, Boxes: []model.ClusterBox{
+				box(3, 3, 0, 3, 2), box(2, 0, 0, 1, 1), box(2, 0, 3, 1, 3),
+			}},
+		},
+		{
+			name: "selected bins",
+			opts: ClusterOptions{Connectivity: 8, Bins: []string{"012"}},
+			want: model.ClusterSummary{Count: 1, Largest: 2, Boxes: []model.ClusterBox{box(2, 0, 3, 1, 3)}},
+		},
+		{
+			// 数量和大小都等于阈值时不标记
+			name: "at thresholds",
+			opts: ClusterOptions{Connectivity: 8, MaxClusters: 3, MaxClusterSize: 3},
+			want: model.ClusterSummary{Count: 3, Largest: 3, Boxes: []model.ClusterBox{
+				box(3, 3, 0, 3, 2), box(2, 0, 0, 1, 1), box(2, 0, 3, 1, 3),
+			}},
+		},
+		{
+			name: "too many clusters",
+			opts: ClusterOptions{Connectivity: 4, MaxClusters: 3},
+			want: model.ClusterSummary{Count: 4, Largest: 3, Flagged: true, Boxes: []model.ClusterBox{
+				box(3, 3, 0, 3, 2), box(2, 0, 3, 1, 3), box(1, 0, 0, 0, 0), box(1, 1, 1, 1, 1),
+			}},
+		},
+		{
+			name: "cluster too large",
+			opts: ClusterOptions{Connectivity: 8, Bins: []string{"012"}, MaxClusterSize: 1},
+			want: model.ClusterSummary{Count: 1, Largest: 2, Flagged: true, Boxes: []model.ClusterBox{box(2, 0, 3, 1, 3)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnalyzeClusters(m, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summary = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := AnalyzeClusters(testMap("good.txt", grid("001 ...", "___ 001")), ClusterOptions{Connectivity: 8, MaxClusters: 1}); got.Count != 0 || got.Flagged {
+		t.Errorf("all good: %+v", got)
+	}
+}
@@ -0,0 +1,205 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"deviceParser/mapping"
+	"deviceParser/model"
+	"deviceParser/parser"
+)
+
+// DuplicatePolicy 决定同一批次中 LOT、WAFER 相同的多个文件 (复测、重复拷贝) 如何处理
+type DuplicatePolicy string
+
+const (
+	DupKeepAll      DuplicatePolicy = "all"      // 全部保留，第二个起记录序号，报表中在批号后加 #2、#3 区分
+	DupKeepNewest   DuplicatePolicy = "newest"   // 只保留修改时间最新的文件
+	DupKeepLastTest DuplicatePolicy = "testdate" // 只保留头部测试时间最新的文件，缺少测试时间时按修改时间
+	DupMerge        DuplicatePolicy = "merge"    // 按测试先后逐 die 合并，后测结果覆盖前测
+)
+
+// DuplicatePolicyLabels 界面中显示的策略名称，顺序即下拉框顺序
+var DuplicatePolicyLabels = []struct {
+	Policy DuplicatePolicy
+	Label  string
+}{
+	{DupKeepAll, "全部保留 (加后缀)"},
+	{DupKeepNewest, "保留修改时间最新"},
+	{DupKeepLastTest, "保留测试时间最新"},
+	{DupMerge, "合并 (后测覆盖前测)"},
+}
+
+// ParseDuplicatePolicy 将用户输入转换为重复处理策略
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	for _, item := range DuplicatePolicyLabels {
+		if string(item.Policy) == s {
+			return item.Policy, nil
+		}
+	}
+	return "", fmt.Errorf("未知的重复处理策略: %s (可选 all/newest/testdate/merge)", s)
+}
+
+// DedupeOptions 重复处理参数
+type DedupeOptions struct {
+	Policy   DuplicatePolicy
+	Rules    []mapping.Rule  // 合并时对每张 map 先做重判，与计数结果保持一致
+	GoodBins []string        // 合并后重新计算良率等使用
+	Clusters *ClusterOptions // 合并后需要重新做失效簇分析时不为空
+	Parser   parser.Options  // 合并时重新读取网格使用的解析参数
+}
+
+// DuplicateGroup 一组 LOT、WAFER 相同的文件，Files 按测试先后排序
+type DuplicateGroup struct {
+	Lot    string
+	Wafer  string
+	Files  []string
+	Policy DuplicatePolicy
+	Kept   string // 保留的文件名，仅 newest/testdate 策略使用
+}
+
+// String 返回便于在界面和命令行中展示的说明
+func (g DuplicateGroup) String() string {
+	files := strings.Join(g.Files, ", ")
+	switch g.Policy {
+	case DupKeepNewest, DupKeepLastTest:
+		return fmt.Sprintf("%s-%s 重复出现在 %s 中，保留 %s", g.Lot, g.Wafer, files, g.Kept)
+	case DupMerge:
+		return fmt.Sprintf("%s-%s 重复出现在 %s 中，已按测试先后合并", g.Lot, g.Wafer, files)
+	}
+	return fmt.Sprintf("%s-%s 重复出现在 %s 中，已加后缀区分", g.Lot, g.Wafer, files)
+}
+
+// resultTime 返回文件用于排序的时间：testdate 与 merge 策略优先使用头部测试时间，其余使用修改时间
+func resultTime(result model.FileResult, policy DuplicatePolicy) time.Time {
+	modTime, _ := parser.SourceModTime(result.SourcePath)
+	if policy == DupKeepNewest {
+		return modTime
+	}
+	return NewTrendWafer(result, modTime).Time
+}
+
+// membersByTime 按排序时间先后排列重复组成员，times 与 members 一一对应
+// 同一多晶圆文件中的多片晶圆共用路径，因此不能按路径记录时间
+type membersByTime struct {
+	members []model.FileResult
+	times   []time.Time
+}
+
+func (s membersByTime) Len() int           { return len(s.members) }
+func (s membersByTime) Less(i, j int) bool { return s.times[i].Before(s.times[j]) }
+func (s membersByTime) Swap(i, j int) {
+	s.members[i], s.members[j] = s.members[j], s.members[i]
+	s.times[i], s.times[j] = s.times[j], s.times[i]
+}
+
+// ResolveDuplicates 检查批次中 LOT、WAFER 相同的结果并按策略处理，返回处理后的结果及全部重复组
+// 结果保持原有顺序，重复组中保留或合并后的结果放在该组第一个文件的位置；
+// 缺少 LOT 或 WAFER 的结果无法判断是否重复，不参与分组，原样保留
+func ResolveDuplicates(results []model.FileResult, opts DedupeOptions) ([]model.FileResult, []DuplicateGroup, error) {
+	type key struct {
+		lot, wafer string
+		index      int // 缺少 LOT 或 WAFER 时为结果序号 + 1，使其单独成组
+	}
+	groups := make(map[key][]int)
+	var order []key
+	for i, result := range results {
+		k := key{lot: result.Lot, wafer: result.Wafer}
+		if result.Lot == "" || result.Wafer == "" {
+			k.index = i + 1
+		}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+	if len(order) == len(results) {
+		return results, nil, nil
+	}
+
+	var resolved []model.FileResult
+	var duplicates []DuplicateGroup
+	for _, k := range order {
+		indexes := groups[k]
+		if len(indexes) == 1 {
+			resolved = append(resolved, results[indexes[0]])
+			continue
+		}
+
+		members := make([]model.FileResult, len(indexes))
+		times := make([]time.Time, len(indexes))
+		for i, idx := range indexes {
+			members[i] = results[idx]
+			times[i] = resultTime(members[i], opts.Policy)
+		}
+		sort.Stable(membersByTime{members, times})
+
+		group := DuplicateGroup{Lot: k.lot, Wafer: k.wafer, Policy: opts.Policy}
+		for _, m := range members {
+			group.Files = append(group.Files, m.FileName)
+		}
+
+		switch opts.Policy {
+		case DupKeepNewest, DupKeepLastTest:
+			latest := members[len(members)-1]
+			group.Kept = latest.FileName
+			resolved = append(resolved, latest)
+		case DupMerge:
+			merged, err := mergeDuplicateResults(members, opts)
+			if err != nil {
+				return nil, nil, fmt.Errorf("合并 %s-%s 失败: %w", k.lot, k.wafer, err)
+			}
+			resolved = append(resolved, merged)
+		default:
+			for i, m := range members {
+				if i > 0 {
+					m.Duplicate = i + 1
+				}
+				resolved = append(resolved, m)
+			}
+		}
+		duplicates = append(duplicates, group)
+	}
+	return resolved, duplicates, nil
+}
+
+// mergeDuplicateResults 读取按测试先后排序的文件完整网格，以后测优先规则合并并重新计数
+func mergeDuplicateResults(members []model.FileResult, opts DedupeOptions) (model.FileResult, error) {
+	maps := make([]model.WaferMap, len(members))
+	for i, m := range members {
+		wm, err := parser.LoadWaferMap(m, opts.Parser)
+		if err != nil {
+			return model.FileResult{}, err
+		}
+		maps[i] = mapping.RebinWaferMap(opts.Rules, wm)
+	}
+	merged, err := MergeWaferMaps(maps, MergeOptions{Rule: MergeLastPass, GoodBins: opts.GoodBins})
+	if err != nil {
+		return model.FileResult{}, err
+	}
+
+	latest := members[len(members)-1]
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.FileName
+	}
+	hash := sha256.Sum256(parser.MarshalWaferMap(merged))
+	result := model.FileResult{
+		FileName:   strings.Join(names, "+"),
+		SourcePath: latest.SourcePath,
+		Lot:        latest.Lot,
+		Wafer:      latest.Wafer,
+		Counts:     merged.Counts(),
+		Metadata:   latest.Metadata,
+		SourceHash: hex.EncodeToString(hash[:]),
+	}
+	if opts.Clusters != nil {
+		summary := AnalyzeClusters(merged, *opts.Clusters)
+		result.Clusters = &summary
+	}
+	return result, nil
+}
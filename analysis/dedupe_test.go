@@ -0,0 +1,173 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"deviceParser/model"
+	"deviceParser/parser"
+)
+
+// dedupeResults 返回 a.txt、c.txt、b.txt 三个文件的结果：a 与 b 同为 A-01，
+// a 的测试时间较早但修改时间较新，c 为 A-02
+func dedupeResults(t *testing.T) []model.FileResult {
+	t.Helper()
+	dir := t.TempDir()
+	files := []struct {
+		name, content string
+		modTime       time.Time
+	}{
+		{"a.txt", "LOT: A\nWAFER: 01\nTEST DATE: 2024-03-01 08:00:00\nRowData: 001 005\nRowData: 001 001\n", time.Date(2024, 3, 10, 0, 0, 0, 0, time.Local)},
+		{"c.txt", "LOT: A\nWAFER: 02\nRowData: 001\n", time.Date(2024, 3, 8, 0, 0, 0, 0, time.Local)},
+		{"b.txt", "LOT: A\nWAFER: 01\nTEST DATE: 2024-03-02 08:00:00\nRowData: 001 001\nRowData: 012 ...\n", time.Date(2024, 3, 9, 0, 0, 0, 0, time.Local)},
+	}
+	var results []model.FileResult
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+		fileResults, err := parser.ParseFile(path, parser.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, fileResults...)
+	}
+	return results
+}
+
+func TestResolveDuplicates(t *testing.T) {
+	type kept struct {
+		file      string
+		wafer     string
+		duplicate int
+		counts    map[string]int
+	}
+	tests := []struct {
+		policy DuplicatePolicy
+		want   []kept
+		files  []string // 重复组中按排序依据的先后
+		kept   string
+	}{
+		{
+			// 按测试先后排列，WAFER 保持不变，序号只记录在 Duplicate 中
+			policy: DupKeepAll,
+			want: []kept{
+				{"a.txt", "01", 0, map[string]int{"001": 3, "005": 1}},
+				{"b.txt", "01", 2, map[string]int{"001": 2, "012": 1}},
+				{"c.txt", "02", 0, map[string]int{"001": 1}},
+			},
+		},
+		{
+			policy: DupKeepNewest,
+			want: []kept{
+				{"a.txt", "01", 0, map[string]int{"001": 3, "005": 1}},
+				{"c.txt", "02", 0, map[string]int{"001": 1}},
+			},
+			files: []string{"b.txt", "a.txt"},
+			kept:  "a.txt",
+		},
+		{
+			policy: DupKeepLastTest,
+			want: []kept{
+				{"b.txt", "01", 0, map[string]int{"001": 2, "012": 1}},
+				{"c.txt", "02", 0, map[string]int{"001": 1}},
+			},
+			kept: "b.txt",
+		},
+		{
+			// 后测覆盖前测，后测未测的 "..." 保留前测结果
+			policy: DupMerge,
+			want: []kept{
+				{"a.txt+b.txt", "01", 0, map[string]int{"001": 3, "012": 1}},
+				{"c.txt", "02", 0, map[string]int{"001": 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			resolved, groups, err := ResolveDuplicates(dedupeResults(t), DedupeOptions{Policy: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []kept
+			for _, r := range resolved {
+				got = append(got, kept{r.FileName, r.Wafer, r.Duplicate, r.Counts})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolved = %+v, want %+v", got, tt.want)
+			}
+			if len(groups) != 1 {
+				t.Fatalf("groups = %+v, want 1", groups)
+			}
+			g := groups[0]
+			if tt.files == nil {
+				tt.files = []string{"a.txt", "b.txt"}
+			}
+			if g.Lot != "A" || g.Wafer != "01" || !reflect.DeepEqual(g.Files, tt.files) || g.Kept != tt.kept {
+				t.Errorf("group = %+v", g)
+			}
+		})
+	}
+}
+
+func TestResolveDuplicatesNone(t *testing.T) {
+	results := dedupeResults(t)[:2]
+	resolved, groups, err := ResolveDuplicates(results, DedupeOptions{Policy: DupMerge})
+	if err != nil || groups != nil || !reflect.DeepEqual(resolved, results) {
+		t.Errorf("resolved = %+v, groups = %+v, err = %v", resolved, groups, err)
+	}
+}
+
+func TestResolveDuplicatesMissingHeader(t *testing.T) {
+	dir := t.TempDir()
+	var results []model.FileResult
+	for _, name := range []string{"x.txt", "y.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("RowData: 001 005\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fileResults, err := parser.ParseFile(path, parser.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, fileResults...)
+	}
+	// 两个文件都没有 LOT、WAFER，不视为重复
+	for _, policy := range []DuplicatePolicy{DupKeepAll, DupKeepNewest, DupMerge} {
+		resolved, groups, err := ResolveDuplicates(results, DedupeOptions{Policy: policy})
+		if err != nil || groups != nil || !reflect.DeepEqual(resolved, results) {
+			t.Errorf("%s: resolved = %+v, groups = %+v, err = %v", policy, resolved, groups, err)
+		}
+	}
+}
+
+func TestResolveDuplicatesSameFile(t *testing.T) {
+	// 同一文件中 A-01 出现两次，第一块的测试时间较晚
+	path := filepath.Join(t.TempDir(), "retest.txt")
+	content := "LOT: A\nWAFER: 01\nTEST DATE: 2024-03-02 08:00:00\nRowData: 001 012\n" +
+		"WAFER: 01\nTEST DATE: 2024-03-01 08:00:00\nRowData: 001 001\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, err := parser.ParseFile(path, parser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %d, want 2", len(results))
+	}
+	resolved, groups, err := ResolveDuplicates(results, DedupeOptions{Policy: DupKeepLastTest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 1 || len(groups) != 1 || resolved[0].Block != 1 || resolved[0].Counts["012"] != 1 {
+		t.Errorf("resolved = %+v, groups = %+v", resolved, groups)
+	}
+}
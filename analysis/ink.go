@@ -0,0 +1,120 @@
+package analysis
+
+import "deviceParser/model"
+
+// InkOptions 打墨参数，各规则的阈值为 0 表示不启用
+// 规则按 邻近失效 -> 边缘 -> 失效簇 的顺序判断，同一个 die 只计入第一条命中的规则
+type InkOptions struct {
+	NeighborFails int      // 良品周围 8 个方向中失效 die 达到该数量时打墨
+	EdgeDistance  int      // 距晶圆边缘不超过该数量 die 的良品打墨 (紧贴边缘为 1)
+	ClusterSize   int      // 失效簇 (8 连通) 大于该大小时，与之相邻的良品打墨
+	InkBin        string   // 打墨后写入的 bin 编号
+	GoodBins      []string // 良品 bin 编号，为空时将数值为 1 的编号视为良品
+}
+
+// InkResult 单个晶圆的打墨结果，以及每条规则剔除的良品数量
+// 同一个 die 命中多条规则时只计入第一条 (邻近失效 -> 边缘 -> 失效簇)
+type InkResult struct {
+	Map      model.WaferMap
+	Neighbor int
+	Edge     int
+	Cluster  int
+}
+
+// Total 返回打墨剔除的 die 总数
+func (r InkResult) Total() int {
+	return r.Neighbor + r.Edge + r.Cluster
+}
+
+// edgeDistances 计算每个 die 到晶圆边缘的距离 (按上下左右步数)
+// "___" 和网格外视为晶圆外，紧贴晶圆外的 die 距离为 1，晶圆外位置为 0
+func edgeDistances(m model.WaferMap) [][]int {
+	dist := make([][]int, len(m.Rows))
+	var queue []model.Pos
+	for i, row := range m.Rows {
+		dist[i] = make([]int, len(row))
+		for j, token := range row {
+			if token == model.EmptyDie {
+				continue
+			}
+			for _, o := range offsets4 {
+				if t, ok := m.At(model.Pos{Row: i + o.Row, Col: j + o.Col}); !ok || t == model.EmptyDie {
+					dist[i][j] = 1
+					queue = append(queue, model.Pos{Row: i, Col: j})
+					break
+				}
+			}
+		}
+	}
+
+	for k := 0; k < len(queue); k++ {
+		cur := queue[k]
+		for _, o := range offsets4 {
+			next := model.Pos{Row: cur.Row + o.Row, Col: cur.Col + o.Col}
+			if t, ok := m.At(next); ok && t != model.EmptyDie && dist[next.Row][next.Col] == 0 {
+				dist[next.Row][next.Col] = dist[cur.Row][cur.Col] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return dist
+}
+
+// InkWaferMap 按规则对良品打墨，返回新的 map，原 map 不变
+// 所有规则都基于打墨前的原始 map 判断，打墨结果不会引发连锁打墨
+func InkWaferMap(m model.WaferMap, opts InkOptions) InkResult {
+	isFail := func(token string) bool {
+		return !model.IsPlaceholder(token) && !model.IsGoodBin(token, opts.GoodBins)
+	}
+
+	// 与超过阈值的失效簇相邻的位置
+	nearCluster := make(map[model.Pos]bool)
+	if opts.ClusterSize > 0 {
+		for _, cluster := range FindClusters(m, isFail, 8) {
+			if len(cluster) <= opts.ClusterSize {
+				continue
+			}
+			for _, p := range cluster {
+				for _, o := range offsets8 {
+					nearCluster[model.Pos{Row: p.Row + o.Row, Col: p.Col + o.Col}] = true
+				}
+			}
+		}
+	}
+
+	var dist [][]int
+	if opts.EdgeDistance > 0 {
+		dist = edgeDistances(m)
+	}
+
+	result := InkResult{Map: m}
+	result.Map.Rows = make([][]string, len(m.Rows))
+	for i, row := range m.Rows {
+		result.Map.Rows[i] = append([]string(nil), row...)
+		for j, token := range row {
+			if model.IsPlaceholder(token) || !model.IsGoodBin(token, opts.GoodBins) {
+				continue
+			}
+
+			fails := 0
+			for _, o := range offsets8 {
+				if t, ok := m.At(model.Pos{Row: i + o.Row, Col: j + o.Col}); ok && isFail(t) {
+					fails++
+				}
+			}
+
+			switch {
+			case opts.NeighborFails > 0 && fails >= opts.NeighborFails:
+				result.Neighbor++
+			case opts.EdgeDistance > 0 && dist[i][j] <= opts.EdgeDistance:
+				result.Edge++
+			case nearCluster[model.Pos{Row: i, Col: j}]:
+				result.Cluster++
+			default:
+				continue
+			}
+			result.Map.Rows[i][j] = opts.InkBin
+		}
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInkWaferMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  [][]string
+		opts  InkOptions
+		want  [][]string
+		count [3]int // 邻近失效、边缘、失效簇各自剔除的数量
+	}{
+		{
+			// 中心良品周围有 3 个失效 die，角上的良品不足 3 个
+			name: "neighbor",
+			rows: grid(
+				"001 001 001",
+				"005 001 005",
+				"001 005 001",
+			),
+			opts: InkOptions{NeighborFails: 3, InkBin: "099"},
+			want: grid(
+				"001 001 001",
+				"005 099 005",
+				"001 005 001",
+			),
+			count: [3]int{1, 0, 0},
+		},
+		{
+			// 紧贴网格边界或 "___" 的 die 距离为 1
+			name: "edge",
+			rows: grid(
+				"___ 001 001 001 ___",
+				"001 001 001 001 001",
+				"001 001 005 001 001",
+				"001 001 001 001 001",
+				"___ 001 001 001 ___",
+			),
+			opts: InkOptions{EdgeDistance: 1, InkBin: "099"},
+			want: grid(
+				"___ 099 099 099 ___",
+				"099 001 001 001 099",
+				"099 001 005 001 099",
+				"099 001 001 001 099",
+				"___ 099 099 099 ___",
+			),
+			count: [3]int{0, 12, 0},
+		},
+		{
+			// 只有大于阈值的簇 (005 两颗) 触发打墨，单颗的 012 不触发
+			name: "cluster",
+			rows: grid(
+				"001 001 001 001 001",
+				"001 005 005 001 001",
+				"001 001 001 001 001",
+				"001 001 001 001 012",
+			),
+			opts: InkOptions{ClusterSize: 1, InkBin: "099"},
+			want: grid(
+				"099 099 099 099 001",
+				"099 005 005 099 001",
+				"099 099 099 099 001",
+				"001 001 001 001 012",
+			),
+			count: [3]int{0, 0, 10},
+		},
+		{
+			// 簇大小等于阈值时不打墨
+			name: "cluster at threshold",
+			rows: grid(
+				"001 001 001",
+				"001 005 005",
+			),
+			opts:  InkOptions{ClusterSize: 2, InkBin: "099"},
+			want:  grid("001 001 001", "001 005 005"),
+			count: [3]int{0, 0, 0},
+		},
+		{
+			// 多条规则同时命中时只计入第一条：邻近失效 -> 边缘 -> 失效簇
+			name: "rule order",
+			rows: grid(
+				"001 001 001 001 001",
+				"001 005 005 001 001",
+				"001 001 001 001 001",
+				"001 001 001 001 012",
+			),
+			opts: InkOptions{NeighborFails: 2, EdgeDistance: 1, ClusterSize: 1, InkBin: "099"},
+			want: grid(
+				"099 099 099 099 099",
+				"099 005 005 099 099",
+				"099 099 099 099 099",
+				"099 099 099 099 012",
+			),
+			count: [3]int{5, 11, 1},
+		},
+		{
+			// 自定义良品 bin：002 是良品，001 按失效处理
+			name: "good bins",
+			rows: grid(
+				"002 001",
+				"001 001",
+			),
+			opts:  InkOptions{NeighborFails: 3, InkBin: "099", GoodBins: []string{"002"}},
+			want:  grid("099 001", "001 001"),
+			count: [3]int{1, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMap("ink.txt", tt.rows)
+			original := grid()
+			for _, row := range tt.rows {
+				original = append(original, append([]string(nil), row...))
+			}
+
+			result := InkWaferMap(m, tt.opts)
+			if !reflect.DeepEqual(result.Map.Rows, tt.want) {
+				t.Errorf("rows =\n%v\nwant\n%v", result.Map.Rows, tt.want)
+			}
+			if got := [3]int{result.Neighbor, result.Edge, result.Cluster}; got != tt.count {
+				t.Errorf("counts = %v, want %v", got, tt.count)
+			}
+			if result.Total() != tt.count[0]+tt.count[1]+tt.count[2] {
+				t.Errorf("total = %d", result.Total())
+			}
+			if !reflect.DeepEqual(m.Rows, original) {
+				t.Error("InkWaferMap modified its input")
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package analysis
+
+import (
+	"fmt"
+	"strconv"
+
+	"deviceParser/model"
+)
+
+// MergeRule 决定同一个 die 在多次测试 (insertion) 中结果不一致时以哪个 bin 为准
+type MergeRule string
+
+const (
+	MergeWorstBin MergeRule = "worst"    // 最差 bin 优先：任一次失效即判为失效
+	MergeLastPass MergeRule = "last"     // 最后一次测试的结果优先
+	MergePriority MergeRule = "priority" // 按用户给定的 bin 优先级列表
+)
+
+// MergeOptions 合并参数
+type MergeOptions struct {
+	Rule     MergeRule
+	Priority []string // 仅 priority 规则使用，越靠前优先级越高
+	GoodBins []string // 良品 bin 编号，为空时将数值为 1 的编号视为良品
+}
+
+// ParseMergeRule 将用户输入转换为合并规则
+func ParseMergeRule(s string) (MergeRule, error) {
+	switch rule := MergeRule(s); rule {
+	case MergeWorstBin, MergeLastPass, MergePriority:
+		return rule, nil
+	}
+	return "", fmt.Errorf("未知的合并规则: %s (可选 worst/last/priority)", s)
+}
+
+// placeholderRank 占位符之间的取舍：真实 bin > "..." > "___"
+func placeholderRank(token string) int {
+	switch token {
+	case model.EmptyDie:
+		return 0
+	case model.SkippedDie:
+		return 1
+	}
+	return 2
+}
+
+// binSeverity 计算失效程度，良品为 0，失效 bin 按编号数值递增，非数字编号视为最差
+func binSeverity(code string, goodBins []string) int {
+	if model.IsGoodBin(code, goodBins) {
+		return 0
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 {
+		return int(^uint(0) >> 1)
+	}
+	return n + 1
+}
+
+// MergeWaferMaps 按测试顺序合并同一晶圆的多张 map，maps[0] 为第一次测试
+func MergeWaferMaps(maps []model.WaferMap, opts MergeOptions) (model.WaferMap, error) {
+	if len(maps) == 0 {
+		return model.WaferMap{}, model.ErrNoData
+	}
+
+	base := maps[0]
+	for _, m := range maps[1:] {
+		if m.Lot != base.Lot || m.Wafer != base.Wafer {
+			return model.WaferMap{}, fmt.Errorf("%s 的扩散批号 %s-%s 与 %s 的 %s-%s 不一致",
+				m.FileName, m.Lot, m.Wafer, base.FileName, base.Lot, base.Wafer)
+		}
+		if len(m.Rows) != len(base.Rows) {
+			return model.WaferMap{}, fmt.Errorf("%s 有 %d 行 RowData，%s 有 %d 行",
+				m.FileName, len(m.Rows), base.FileName, len(base.Rows))
+		}
+		for i := range m.Rows {
+			if len(m.Rows[i]) != len(base.Rows[i]) {
+				return model.WaferMap{}, fmt.Errorf("第 %d 行 RowData 长度不一致: %s 为 %d，%s 为 %d",
+					i+1, m.FileName, len(m.Rows[i]), base.FileName, len(base.Rows[i]))
+			}
+		}
+	}
+
+	priority := make(map[string]int, len(opts.Priority))
+	for i, code := range opts.Priority {
+		if _, ok := priority[code]; !ok {
+			priority[code] = i
+		}
+	}
+
+	// prefer 返回 true 表示后一次测试的 next 应覆盖当前的 cur
+	prefer := func(cur, next string) bool {
+		if model.IsPlaceholder(cur) || model.IsPlaceholder(next) {
+			return placeholderRank(next) >= placeholderRank(cur)
+		}
+		switch opts.Rule {
+		case MergeWorstBin:
+			return binSeverity(next, opts.GoodBins) >= binSeverity(cur, opts.GoodBins)
+		case MergePriority:
+			pCur, okCur := priority[cur]
+			pNext, okNext := priority[next]
+			if okCur && okNext {
+				return pNext <= pCur
+			}
+			if okCur != okNext {
+				return okNext
+			}
+		}
+		return true
+	}
+
+	merged := model.WaferMap{
+		FileName: base.FileName,
+		Lot:      base.Lot,
+		Wafer:    base.Wafer,
+		Rows:     make([][]string, len(base.Rows)),
+
+		Header:     base.Header,
+		Trailer:    base.Trailer,
+		Lines:      base.Lines,
+		LineEnding: base.LineEnding,
+		Encoding:   base.Encoding,
+	}
+	for i, row := range base.Rows {
+		merged.Rows[i] = append([]string(nil), row...)
+	}
+	for _, m := range maps[1:] {
+		for i, row := range m.Rows {
+			for j, token := range row {
+				if prefer(merged.Rows[i][j], token) {
+					merged.Rows[i][j] = token
+				}
+			}
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,143 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"deviceParser/model"
+)
+
+// grid 将每行以空格分隔的 token 转换为 map 网格，供本包测试直接书写晶圆图
+func grid(lines ...string) [][]string {
+	rows := make([][]string, len(lines))
+	for i, line := range lines {
+		rows[i] = strings.Fields(line)
+	}
+	return rows
+}
+
+// testMap 返回 LOT A、WAFER 01 的晶圆图
+func testMap(name string, rows [][]string) model.WaferMap {
+	return model.WaferMap{FileName: name, Lot: "A", Wafer: "01", Rows: rows}
+}
+
+func TestMergeWaferMaps(t *testing.T) {
+	first := testMap("t1.txt", grid(
+		"___ 001 005 012",
+		"... 001 0A1 001",
+		"001 ... ___ 012",
+	))
+	second := testMap("t2.txt", grid(
+		"... 012 001 005",
+		"001 099 099 ___",
+		"... 005 ... 001",
+	))
+
+	tests := []struct {
+		name string
+		opts MergeOptions
+		want [][]string
+	}{
+		{
+			// 编号数值大者为准，非数字编号最差；真实 bin > "..." > "___"
+			name: "worst",
+			opts: MergeOptions{Rule: MergeWorstBin},
+			want: grid(
+				"... 012 005 012",
+				"001 099 0A1 001",
+				"001 005 ... 012",
+			),
+		},
+		{
+			name: "last",
+			opts: MergeOptions{Rule: MergeLastPass},
+			want: grid(
+				"... 012 001 005",
+				"001 099 099 001",
+				"001 005 ... 001",
+			),
+		},
+		{
+			// 优先级列表中的编号优先于列表外的编号，列表外的编号按后测覆盖前测
+			name: "priority",
+			opts: MergeOptions{Rule: MergePriority, Priority: []string{"005", "001"}},
+			want: grid(
+				"... 001 005 005",
+				"001 001 099 001",
+				"001 005 ... 001",
+			),
+		},
+		{
+			// 自定义良品 bin 时数值为 1 的编号也按失效处理
+			name: "worst with good bins",
+			opts: MergeOptions{Rule: MergeWorstBin, GoodBins: []string{"012"}},
+			want: grid(
+				"... 001 005 005",
+				"001 099 0A1 001",
+				"001 005 ... 001",
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeWaferMaps([]model.WaferMap{first, second}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(merged.Rows, tt.want) {
+				t.Errorf("rows =\n%v\nwant\n%v", merged.Rows, tt.want)
+			}
+			if merged.FileName != "t1.txt" || merged.Lot != "A" || merged.Wafer != "01" {
+				t.Errorf("header = %q %q %q", merged.FileName, merged.Lot, merged.Wafer)
+			}
+		})
+	}
+
+	// 输入不被修改
+	if first.Rows[0][0] != model.EmptyDie {
+		t.Error("MergeWaferMaps modified its input")
+	}
+}
+
+func TestMergeWaferMapsPlaceholders(t *testing.T) {
+	for _, tt := range []struct{ cur, next, want string }{
+		{model.EmptyDie, model.SkippedDie, model.SkippedDie},
+		{model.SkippedDie, model.EmptyDie, model.SkippedDie},
+		{model.SkippedDie, "001", "001"},
+		{"001", model.SkippedDie, "001"},
+		{"005", model.EmptyDie, "005"},
+		{model.EmptyDie, "005", "005"},
+	} {
+		for _, rule := range []MergeRule{MergeWorstBin, MergeLastPass, MergePriority} {
+			merged, err := MergeWaferMaps([]model.WaferMap{
+				testMap("t1.txt", grid(tt.cur)),
+				testMap("t2.txt", grid(tt.next)),
+			}, MergeOptions{Rule: rule, Priority: []string{"001"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := merged.Rows[0][0]; got != tt.want {
+				t.Errorf("%s: %s then %s = %s, want %s", rule, tt.cur, tt.next, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestMergeWaferMapsMismatch(t *testing.T) {
+	base := testMap("t1.txt", grid("001 001", "001 001"))
+	otherWafer := testMap("t2.txt", grid("001 001", "001 001"))
+	otherWafer.Wafer = "02"
+	for name, m := range map[string]model.WaferMap{
+		"wafer":   otherWafer,
+		"rows":    testMap("t2.txt", grid("001 001")),
+		"columns": testMap("t2.txt", grid("001 001", "001 001 001")),
+	} {
+		if _, err := MergeWaferMaps([]model.WaferMap{base, m}, MergeOptions{Rule: MergeWorstBin}); err == nil {
+			t.Errorf("%s mismatch: expected error", name)
+		}
+	}
+	if _, err := MergeWaferMaps(nil, MergeOptions{}); err != model.ErrNoData {
+		t.Errorf("no maps: err = %v, want ErrNoData", err)
+	}
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"deviceParser/model"
+)
+
+// testDateKeys 头部信息中可能表示测试时间的键 (已去掉空格、下划线并转为大写)
+var testDateKeys = []string{"TESTDATE", "TESTTIME", "TESTSTARTTIME", "STARTTIME", "DATE"}
+
+// testDateLayouts 测试时间支持的格式
+var testDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04",
+	"01/02/2006 15:04:05",
+	"20060102 150405",
+	"20060102150405",
+	"2006-01-02",
+	"2006/01/02",
+	"20060102",
+}
+
+// TestDate 从头部元数据中解析测试时间
+func TestDate(metadata map[string]string) (time.Time, bool) {
+	normalized := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		key := strings.ToUpper(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(k))
+		normalized[key] = v
+	}
+	for _, key := range testDateKeys {
+		value, ok := normalized[key]
+		if !ok {
+			continue
+		}
+		for _, layout := range testDateLayouts {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// TrendWafer 参与趋势分析的单片晶圆，Time 优先取头部的测试时间
+type TrendWafer struct {
+	Result model.FileResult
+	Time   time.Time
+}
+
+// NewTrendWafer 使用头部测试时间，缺失时使用 fallback (如导入时间或文件修改时间)
+func NewTrendWafer(result model.FileResult, fallback time.Time) TrendWafer {
+	if t, ok := TestDate(result.Metadata); ok {
+		return TrendWafer{Result: result, Time: t}
+	}
+	return TrendWafer{Result: result, Time: fallback}
+}
+
+// LotTrend 单个 LOT 的汇总数据，Time 为该 LOT 最早一片晶圆的测试时间
+type LotTrend struct {
+	Lot    string
+	Time   time.Time
+	Wafers int
+	Dies   int
+	Good   int
+	Counts map[string]int
+}
+
+// Yield 返回该 LOT 的良率百分比
+func (l LotTrend) Yield() float64 {
+	if l.Dies == 0 {
+		return 0
+	}
+	return float64(l.Good) * 100 / float64(l.Dies)
+}
+
+// Percent 返回某个 bin 在该 LOT 中的占比
+func (l LotTrend) Percent(code string) float64 {
+	if l.Dies == 0 {
+		return 0
+	}
+	return float64(l.Counts[code]) * 100 / float64(l.Dies)
+}
+
+// BuildLotTrends 按 LOT 汇总并按测试时间排序，同时返回全部 LOT 中数量最多的 topN 个失效 bin
+func BuildLotTrends(wafers []TrendWafer, goodBins []string, topN int) ([]LotTrend, []string) {
+	byLot := make(map[string]*LotTrend)
+	failTotals := make(map[string]int)
+	for _, w := range wafers {
+		lot, ok := byLot[w.Result.Lot]
+		if !ok {
+			lot = &LotTrend{Lot: w.Result.Lot, Time: w.Time, Counts: make(map[string]int)}
+			byLot[w.Result.Lot] = lot
+		}
+		if w.Time.Before(lot.Time) {
+			lot.Time = w.Time
+		}
+		lot.Wafers++
+		for code, n := range w.Result.Counts {
+			lot.Dies += n
+			lot.Counts[code] += n
+			if model.IsGoodBin(code, goodBins) {
+				lot.Good += n
+			} else {
+				failTotals[code] += n
+			}
+		}
+	}
+
+	lots := make([]LotTrend, 0, len(byLot))
+	for _, lot := range byLot {
+		lots = append(lots, *lot)
+	}
+	sort.Slice(lots, func(i, j int) bool {
+		if !lots[i].Time.Equal(lots[j].Time) {
+			return lots[i].Time.Before(lots[j].Time)
+		}
+		return lots[i].Lot < lots[j].Lot
+	})
+
+	var topBins []string
+	for code := range failTotals {
+		topBins = append(topBins, code)
+	}
+	sort.Slice(topBins, func(i, j int) bool {
+		if failTotals[topBins[i]] != failTotals[topBins[j]] {
+			return failTotals[topBins[i]] > failTotals[topBins[j]]
+		}
+		return topBins[i] < topBins[j]
+	})
+	if len(topBins) > topN {
+		topBins = topBins[:topN]
+	}
+	return lots, topBins
+}
@@ -0,0 +1,94 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"deviceParser/model"
+)
+
+func TestTestDate(t *testing.T) {
+	want := time.Date(2024, 3, 5, 14, 7, 9, 0, time.Local)
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		metadata map[string]string
+		want     time.Time
+		ok       bool
+	}{
+		{map[string]string{"TEST DATE": "2024-03-05 14:07:09"}, want, true},
+		{map[string]string{"Test_Date": "2024/03/05 14:07:09"}, want, true},
+		{map[string]string{"TEST-TIME": "03/05/2024 14:07:09"}, want, true},
+		{map[string]string{"START TIME": "20240305 140709"}, want, true},
+		{map[string]string{"TEST START TIME": "20240305140709"}, want, true},
+		{map[string]string{"TEST DATE": "2024-03-05 14:07"}, want.Truncate(time.Minute), true},
+		{map[string]string{"DATE": "2024/03/05"}, day, true},
+		{map[string]string{"DATE": "20240305"}, day, true},
+		{map[string]string{"TEST DATE": "2024-03-05T14:07:09+08:00"}, time.Date(2024, 3, 5, 14, 7, 9, 0, time.FixedZone("", 8*3600)), true},
+		// TESTDATE 优先于 DATE
+		{map[string]string{"DATE": "2020-01-01", "TEST DATE": "2024-03-05"}, day, true},
+		// 无法解析的键被跳过，继续尝试后面的键
+		{map[string]string{"TEST DATE": "yesterday", "DATE": "2024-03-05"}, day, true},
+		{map[string]string{"TEST DATE": "05.03.2024"}, time.Time{}, false},
+		{map[string]string{"DEVICE": "2024-03-05"}, time.Time{}, false},
+		{nil, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := TestDate(tt.metadata)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("TestDate(%v) = %v, %v, want %v, %v", tt.metadata, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	fallback := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	if w := NewTrendWafer(model.FileResult{}, fallback); !w.Time.Equal(fallback) {
+		t.Errorf("fallback time = %v", w.Time)
+	}
+}
+
+func TestBuildLotTrends(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.Local) }
+	wafer := func(lot string, d int, counts map[string]int) TrendWafer {
+		return TrendWafer{Result: model.FileResult{Lot: lot, Counts: counts}, Time: day(d)}
+	}
+	wafers := []TrendWafer{
+		wafer("L2", 4, map[string]int{"001": 90, "005": 6, "012": 4}),
+		wafer("L1", 6, map[string]int{"001": 80, "005": 20}),
+		wafer("L1", 2, map[string]int{"001": 95, "012": 3, "020": 2}),
+		wafer("L3", 4, map[string]int{"001": 99, "020": 1}),
+	}
+
+	lots, topBins := BuildLotTrends(wafers, nil, 2)
+	// L1 最早一片为 3 月 2 日；L2、L3 同为 3 月 4 日时按 LOT 名称排序
+	var order []string
+	for _, lot := range lots {
+		order = append(order, lot.Lot)
+	}
+	if !reflect.DeepEqual(order, []string{"L1", "L2", "L3"}) {
+		t.Errorf("lot order = %v", order)
+	}
+	l1 := lots[0]
+	if !l1.Time.Equal(day(2)) || l1.Wafers != 2 || l1.Dies != 200 || l1.Good != 175 || l1.Counts["005"] != 20 {
+		t.Errorf("L1 = %+v", l1)
+	}
+	if l1.Yield() != 87.5 || l1.Percent("012") != 1.5 {
+		t.Errorf("L1 yield = %v, 012 = %v", l1.Yield(), l1.Percent("012"))
+	}
+
+	// 主要失效 bin 按全部 LOT 的总数选取：005 26 颗、012 7 颗、020 3 颗
+	if !reflect.DeepEqual(topBins, []string{"005", "012"}) {
+		t.Errorf("top bins = %v", topBins)
+	}
+	if _, topBins := BuildLotTrends(wafers, nil, 10); !reflect.DeepEqual(topBins, []string{"005", "012", "020"}) {
+		t.Errorf("top 10 = %v", topBins)
+	}
+	if _, topBins := BuildLotTrends(wafers, nil, 0); len(topBins) != 0 {
+		t.Errorf("top 0 = %v", topBins)
+	}
+
+	// 数量相同时按编号排序；自定义良品 bin 不计入失效
+	_, topBins = BuildLotTrends([]TrendWafer{wafer("L1", 1, map[string]int{"001": 5, "030": 2, "010": 2, "002": 9})}, []string{"002"}, 2)
+	if !reflect.DeepEqual(topBins, []string{"001", "010"}) {
+		t.Errorf("tie-break = %v", topBins)
+	}
+}
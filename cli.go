@@ -0,0 +1,928 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"deviceParser/analysis"
+	"deviceParser/mapgen"
+	"deviceParser/mapping"
+	"deviceParser/mes"
+	"deviceParser/model"
+	"deviceParser/parser"
+	"deviceParser/report"
+	"deviceParser/spc"
+	"deviceParser/store"
+)
+
+// exitAlarm 存在超出 SBL 限值的晶圆时的退出码，便于脚本判断
+const exitAlarm = 3
+
+// runCLI 在带命令行参数启动时执行对应的子命令，返回进程退出码
+func runCLI(args []string) int {
+	switch args[0] {
+	case "process":
+		return runProcessCommand(args[1:])
+	case "query":
+		return runQueryCommand(args[1:])
+	case "trend":
+		return runTrendCommand(args[1:])
+	case "merge":
+		return runMergeCommand(args[1:])
+	case "ink":
+		return runInkCommand(args[1:])
+	case "generate":
+		return runGenerateCommand(args[1:])
+	case "watch":
+		return runWatchCommand(args[1:])
+	case "serve":
+		return runServeCommand(args[1:])
+	case "validate":
+		return runValidateCommand(args[1:])
+	case "help", "-h", "-help", "--help":
+		printUsage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", args[0])
+		printUsage()
+		return 2
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `用法:
+  deviceParser                           启动图形界面
+  deviceParser process [选项] 文件/文件夹... 提取数据并生成汇总 Excel，有文件处理失败时退出码为 1，存在超限晶圆时为 3
+  deviceParser query [选项]                 按 LOT、产品、日期范围查询本地数据库中的历史良率
+  deviceParser trend [选项] [文件/文件夹...] 生成按测试日期排列的 LOT 良率趋势报告 (无输入时读取本地数据库)
+  deviceParser merge [选项] 文件...        按测试顺序合并同一晶圆的多次测试结果
+  deviceParser ink [选项] 文件/文件夹...   按邻近失效、边缘、失效簇规则对良品打墨
+  deviceParser generate [选项]              生成合成的晶圆 map，用于演示与压力测试
+  deviceParser watch [选项] 文件夹...       监视文件夹，自动处理新写入的 .txt 文件及 .zip/.gz 压缩包并更新滚动汇总
+  deviceParser validate [选项] 文件/文件夹... 校验文件格式，按 文件:行:列 列出问题，存在错误时退出码为 1
+  deviceParser serve [选项]                 启动本地 HTTP 接口，提供解析、报表及映射配置管理
+
+报表模板 (process、watch 的 -template 选项) 中可用的占位符:`)
+	fmt.Fprintln(os.Stderr, report.TemplateHelp)
+}
+
+// loadSettings 按 -profile、-encoding 参数创建配置，encoding 为空时沿用映射配置中的编码
+func loadSettings(profilePath, encoding string) (*settings, error) {
+	if err := parser.ValidateEncoding(encoding); err != nil {
+		return nil, err
+	}
+	cfg := newSettings()
+	if profilePath != "" {
+		profile, err := mapping.LoadProfile(profilePath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.applyProfile(profile)
+	}
+	if encoding != "" {
+		cfg.Profile.Encoding = encoding
+	}
+	return cfg, nil
+}
+
+// writeRebinMaps 读取文件的完整网格，重判后每片晶圆写出一个 <文件名>_rebin.txt
+func writeRebinMaps(dir, fPath string, opts parser.Options, rules []mapping.Rule, wafers int) error {
+	maps, err := parser.ReadWaferMaps(fPath, opts)
+	if err == nil && len(maps) != wafers {
+		err = fmt.Errorf("网格中有 %d 片晶圆，应为 %d", len(maps), wafers)
+	}
+	if err != nil {
+		return fmt.Errorf("读取 map 失败: %w", err)
+	}
+	for _, m := range maps {
+		m = mapping.RebinWaferMap(rules, m)
+		if err := parser.WriteWaferMap(filepath.Join(dir, report.FileNameStem(m.FileName, m.Block)+"_rebin.txt"), m); err != nil {
+			return fmt.Errorf("写入重判 map 失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// splitList 将逗号分隔的参数拆分为列表，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseDateFlag 解析 YYYY-MM-DD 格式的日期，空字符串返回零值
+func parseDateFlag(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("日期 %q 格式应为 YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// trendWafersFromStore 将数据库记录转换为趋势数据，缺少测试时间时使用导入时间
+func trendWafersFromStore(wafers []store.Wafer) []analysis.TrendWafer {
+	trend := make([]analysis.TrendWafer, 0, len(wafers))
+	for _, w := range wafers {
+		trend = append(trend, analysis.NewTrendWafer(w.ToFileResult(), w.RunTime))
+	}
+	return trend
+}
+
+func runProcessCommand(args []string) int {
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	profileFlag := fs.String("profile", "", "映射配置文件 (JSON)，包含名称映射、良品 bin 与 SBL 限值")
+	rulesFlag := fs.String("rules", "", "重判规则文件 (JSON)")
+	rebinMapsFlag := fs.String("rebinmaps", "", "重判后 map 文件的输出文件夹，每片晶圆写出一个 <文件名>_rebin.txt (需同时指定 -rules)")
+	outFlag := fs.String("o", "", "汇总 Excel 输出路径 (必填)")
+	titleFlag := fs.String("title", "处理结果", "汇总表标题")
+	templateFlag := fs.String("template", "", "xlsx 报表模板，指定后按模板填充占位符 (见 deviceParser help)")
+	dbFlag := fs.String("db", "", "本地数据库路径 (默认位于用户配置目录)")
+	noSaveFlag := fs.Bool("nosave", false, "不将结果保存到本地数据库")
+	mesFlag := fs.String("mes", "", "MES 上传地址，覆盖映射配置中的设置")
+	strictFlag := fs.Bool("strict", false, "严格校验，拒绝存在错误级别问题的文件")
+	dupFlag := fs.String("dup", string(analysis.DupKeepAll), "LOT、WAFER 重复时的处理策略: all (加后缀全部保留)/newest (修改时间最新)/testdate (测试时间最新)/merge (后测覆盖前测)")
+	encodingFlag := fs.String("encoding", "", "map 文件编码: auto/utf-8/gbk/utf-16le/utf-16be，覆盖映射配置中的设置")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := newSettings()
+	if err := parser.ValidateEncoding(*encodingFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	policy, err := analysis.ParseDuplicatePolicy(*dupFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *outFlag == "" || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "process 需要 -o 输出路径以及至少一个输入")
+		fs.Usage()
+		return 2
+	}
+
+	if *profileFlag != "" {
+		profile, err := mapping.LoadProfile(*profileFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		cfg.applyProfile(profile)
+	}
+	if *rulesFlag != "" {
+		rules, err := mapping.LoadRules(*rulesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		cfg.Rules = rules
+	}
+	if *rebinMapsFlag != "" {
+		if len(cfg.Rules) == 0 {
+			fmt.Fprintln(os.Stderr, "-rebinmaps 需要同时通过 -rules 指定重判规则")
+			return 2
+		}
+		if err := os.MkdirAll(*rebinMapsFlag, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "创建输出目录失败: %v\n", err)
+			return 1
+		}
+	}
+	if *mesFlag != "" {
+		if err := cfg.overrideMESURL(*mesFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if *encodingFlag != "" {
+		cfg.Profile.Encoding = *encodingFlag
+	}
+	if *templateFlag != "" {
+		if err := report.CheckTemplate(*templateFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		cfg.Template = *templateFlag
+	}
+
+	archives := parser.NewArchives()
+	defer archives.Close()
+	files, failed, err := parser.CollectFiles(fs.Args(), archives)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	parserOpts := cfg.Profile.ParserOptions()
+	parserOpts.Strict = *strictFlag
+	parserOpts.Archives = archives
+
+	// 单个文件出错时继续处理其余文件，全部结果写入汇总表的 Log 工作表
+	var results []model.FileResult
+	outcomes := failed
+	for _, o := range failed {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", o.Path, o.Detail)
+	}
+	for _, fPath := range files {
+		fileResults, outcome, err := parser.Extract(fPath, parserOpts)
+		if err == nil && *rebinMapsFlag != "" {
+			if err = writeRebinMaps(*rebinMapsFlag, fPath, parserOpts, cfg.Rules, len(fileResults)); err != nil {
+				outcome.Fail(err)
+			}
+		}
+		outcomes = append(outcomes, outcome)
+		if err != nil {
+			if !errors.Is(err, model.ErrNoData) {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", fPath, outcome.Detail)
+			}
+			continue
+		}
+		for _, result := range fileResults {
+			results = append(results, mapping.RebinCounts(cfg.Rules, result))
+		}
+	}
+
+	results, duplicates, err := analysis.ResolveDuplicates(results, analysis.DedupeOptions{Policy: policy, Rules: cfg.Rules, GoodBins: cfg.Profile.GoodBins, Parser: parserOpts})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, group := range duplicates {
+		fmt.Fprintf(os.Stderr, "警告: %s\n", group)
+	}
+
+	mapping.ApplyLimits(results, cfg.Profile.Limits(), cfg.Profile.GoodBins)
+	if cfg.Profile.SPC != nil {
+		if err := spc.Run(results, cfg.Profile.Product, *cfg.Profile.SPC, cfg.Profile.GoodBins); err != nil {
+			fmt.Fprintf(os.Stderr, "SPC 检查失败: %v\n", err)
+			return 1
+		}
+	}
+	violating := model.CountViolating(results)
+	if err := cfg.writeSummary(*outFlag, *titleFlag, results, outcomes); err != nil {
+		fmt.Fprintf(os.Stderr, "写入汇总文件失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s，结果保存在: %s\n", model.OutcomeSummary(outcomes), *outFlag)
+
+	if !*noSaveFlag {
+		if err := store.SaveResults(*dbFlag, results, cfg.Profile.Product); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	// 上传失败不影响退出码，失败的记录保存在待发送目录中，下次运行时补发
+	if cfg.Profile.MES != nil {
+		mesReport, err := mes.Push(results, cfg.Profile.Product, *cfg.Profile.MES, cfg.Profile.GoodBins)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(strings.TrimPrefix(mesReport.Note(), "\n"))
+	}
+
+	if violating > 0 {
+		fmt.Printf("%d 个晶圆超出限值:\n", violating)
+		for _, result := range results {
+			for _, a := range result.Alarms {
+				fmt.Printf("  %s-%s: %s\n", result.Lot, result.Wafer, a)
+			}
+		}
+	}
+	switch {
+	case model.CountFailed(outcomes) > 0:
+		return 1
+	case violating > 0:
+		return exitAlarm
+	}
+	return 0
+}
+
+func runQueryCommand(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	dbFlag := fs.String("db", "", "本地数据库路径 (默认位于用户配置目录)")
+	lotFlag := fs.String("lot", "", "LOT 前缀")
+	productFlag := fs.String("product", "", "产品名")
+	fromFlag := fs.String("from", "", "运行日期下限 YYYY-MM-DD (含当天)")
+	toFlag := fs.String("to", "", "运行日期上限 YYYY-MM-DD (含当天)")
+	goodFlag := fs.String("good", "", "良品 bin 编号，逗号分隔 (默认数值为 1 的编号)")
+	outFlag := fs.String("o", "", "将查询结果导出为 Excel")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	q := store.Query{Lot: *lotFlag, Product: *productFlag}
+	var err error
+	if q.From, err = parseDateFlag(*fromFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if q.To, err = parseDateFlag(*toFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !q.To.IsZero() {
+		q.To = q.To.AddDate(0, 0, 1)
+	}
+
+	dbPath := *dbFlag
+	if dbPath == "" {
+		if dbPath, err = store.DefaultPath(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	db, err := store.Open(dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	wafers, err := db.Query(q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(wafers) == 0 {
+		fmt.Println("没有符合条件的记录")
+		return 0
+	}
+
+	goodBins := splitList(*goodFlag)
+	var results []model.FileResult
+	fmt.Printf("%-20s %-12s %-20s %8s %8s  %s\n", "运行时间", "产品", "扩散批号", "die数", "良率", "文件名")
+	for _, w := range wafers {
+		result := w.ToFileResult()
+		fmt.Printf("%-20s %-12s %-20s %8d %7.2f%%  %s\n",
+			w.RunTime.Local().Format("2006-01-02 15:04:05"), w.Product, w.Lot+"-"+w.Wafer,
+			result.TotalDies(), result.Yield(goodBins), w.FileName)
+		results = append(results, result)
+	}
+
+	if *outFlag != "" {
+		if err := report.WriteSummary(*outFlag, "历史查询", results, model.BinNames{Prefix: mapping.DefaultPrefix}, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "导出失败: %v\n", err)
+			return 1
+		}
+		fmt.Printf("已导出 %d 条记录到: %s\n", len(results), *outFlag)
+	}
+	return 0
+}
+
+func runTrendCommand(args []string) int {
+	fs := flag.NewFlagSet("trend", flag.ContinueOnError)
+	dbFlag := fs.String("db", "", "本地数据库路径 (默认位于用户配置目录)")
+	lotFlag := fs.String("lot", "", "LOT 前缀 (仅读取数据库时使用)")
+	productFlag := fs.String("product", "", "产品名 (仅读取数据库时使用)")
+	fromFlag := fs.String("from", "", "运行日期下限 YYYY-MM-DD (仅读取数据库时使用)")
+	toFlag := fs.String("to", "", "运行日期上限 YYYY-MM-DD，含当天 (仅读取数据库时使用)")
+	profileFlag := fs.String("profile", "", "映射配置文件 (JSON)，用于 bin 名称和良品 bin")
+	topFlag := fs.Int("top", 5, "报告中列出的主要失效 bin 数量")
+	outFlag := fs.String("o", "", "趋势报告输出路径 (必填)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := newSettings()
+	if *outFlag == "" {
+		fmt.Fprintln(os.Stderr, "trend 需要 -o 输出路径")
+		fs.Usage()
+		return 2
+	}
+	if *topFlag < 0 {
+		fmt.Fprintln(os.Stderr, "-top 必须大于或等于 0")
+		return 2
+	}
+	if *profileFlag != "" {
+		profile, err := mapping.LoadProfile(*profileFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		cfg.applyProfile(profile)
+	}
+
+	var wafers []analysis.TrendWafer
+	if fs.NArg() > 0 {
+		// 重新解析输入文件，缺少测试时间时使用文件修改时间
+		archives := parser.NewArchives()
+		defer archives.Close()
+		files, failed, err := parser.CollectFiles(fs.Args(), archives)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, o := range failed {
+			fmt.Fprintf(os.Stderr, "跳过 %s: %s\n", o.Path, o.Detail)
+		}
+		parserOpts := cfg.Profile.ParserOptions()
+		parserOpts.Archives = archives
+		for _, fPath := range files {
+			fileResults, err := parser.ParseFile(fPath, parserOpts)
+			if err != nil {
+				if errors.Is(err, model.ErrNoData) {
+					continue // 静默跳过没有数据的文件
+				}
+				fmt.Fprintf(os.Stderr, "解析文件 %s 失败: %v\n", fPath, err)
+				return 1
+			}
+			modTime, _ := parser.SourceModTime(fPath)
+			for _, result := range fileResults {
+				wafers = append(wafers, analysis.NewTrendWafer(mapping.RebinCounts(cfg.Rules, result), modTime))
+			}
+		}
+	} else {
+		q := store.Query{Lot: *lotFlag, Product: *productFlag}
+		var err error
+		if q.From, err = parseDateFlag(*fromFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if q.To, err = parseDateFlag(*toFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if !q.To.IsZero() {
+			q.To = q.To.AddDate(0, 0, 1)
+		}
+
+		dbPath := *dbFlag
+		if dbPath == "" {
+			if dbPath, err = store.DefaultPath(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		db, err := store.Open(dbPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		stored, err := db.Query(q)
+		db.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		wafers = trendWafersFromStore(stored)
+	}
+
+	lots, topBins := analysis.BuildLotTrends(wafers, cfg.Profile.GoodBins, *topFlag)
+	if err := report.WriteTrend(*outFlag, lots, topBins, cfg.Profile.BinNames()); err != nil {
+		if errors.Is(err, model.ErrNoData) {
+			fmt.Fprintln(os.Stderr, "没有可用于趋势分析的数据")
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "写入趋势报告失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已汇总 %d 个 LOT (%d 片晶圆)，趋势报告: %s\n", len(lots), len(wafers), *outFlag)
+	return 0
+}
+
+func runMergeCommand(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	ruleFlag := fs.String("rule", string(analysis.MergeWorstBin), "合并规则: worst (最差 bin 优先) / last (最后一次优先) / priority (按优先级列表)")
+	priorityFlag := fs.String("priority", "", "priority 规则使用的 bin 优先级，逗号分隔，越靠前优先级越高")
+	goodFlag := fs.String("good", "", "良品 bin 编号，逗号分隔，覆盖映射配置中的设置 (默认数值为 1 的编号)")
+	outFlag := fs.String("o", "", "合并后的 map 输出路径 (必填)")
+	xlsxFlag := fs.String("xlsx", "", "汇总 Excel 输出路径 (默认与 -o 同名的 .xlsx)")
+	prefixFlag := fs.String("prefix", "", "未配置映射的 bin 名称前缀，覆盖映射配置中的设置 (默认 "+mapping.DefaultPrefix+")")
+	profileFlag := fs.String("profile", "", "映射配置文件 (JSON)，提供名称映射、良品 bin 与文件编码")
+	encodingFlag := fs.String("encoding", "", "map 文件编码: auto/utf-8/gbk/utf-16le/utf-16be，覆盖映射配置中的设置")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	rule, err := analysis.ParseMergeRule(*ruleFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *outFlag == "" || fs.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "merge 需要 -o 输出路径以及至少两个输入文件")
+		fs.Usage()
+		return 2
+	}
+	cfg, err := loadSettings(*profileFlag, *encodingFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *prefixFlag != "" {
+		cfg.Profile.Prefix = *prefixFlag
+	}
+	if *goodFlag != "" {
+		cfg.Profile.GoodBins = splitList(*goodFlag)
+	}
+	opts := analysis.MergeOptions{Rule: rule, Priority: splitList(*priorityFlag), GoodBins: cfg.Profile.GoodBins}
+	if rule == analysis.MergePriority && len(opts.Priority) == 0 {
+		fmt.Fprintln(os.Stderr, "priority 规则需要通过 -priority 指定 bin 优先级")
+		return 2
+	}
+
+	var maps []model.WaferMap
+	for _, fPath := range fs.Args() {
+		fileMaps, err := parser.ReadWaferMaps(fPath, cfg.Profile.ParserOptions())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "解析文件 %s 失败: %v\n", fPath, err)
+			return 1
+		}
+		maps = append(maps, fileMaps...)
+	}
+
+	merged, err := analysis.MergeWaferMaps(maps, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "合并失败: %v\n", err)
+		return 1
+	}
+	merged.FileName = filepath.Base(*outFlag)
+	if err := parser.WriteWaferMap(*outFlag, merged); err != nil {
+		fmt.Fprintf(os.Stderr, "写入合并文件失败: %v\n", err)
+		return 1
+	}
+
+	xlsxPath := *xlsxFlag
+	if xlsxPath == "" {
+		xlsxPath = strings.TrimSuffix(*outFlag, filepath.Ext(*outFlag)) + ".xlsx"
+	}
+	title := fmt.Sprintf("合并结果 (%d 次测试)", len(maps))
+	if err := report.WriteSummary(xlsxPath, title, []model.FileResult{merged.ToFileResult()}, cfg.Profile.BinNames(), nil); err != nil {
+		fmt.Fprintf(os.Stderr, "写入汇总文件失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("已合并 %d 个文件\n合并 map: %s\n汇总结果: %s\n", len(maps), *outFlag, xlsxPath)
+	return 0
+}
+
+func runInkCommand(args []string) int {
+	fs := flag.NewFlagSet("ink", flag.ContinueOnError)
+	neighborFlag := fs.Int("neighbors", 0, "良品周围失效 die 达到该数量时打墨 (0 表示不启用)")
+	edgeFlag := fs.Int("edge", 0, "距晶圆边缘不超过该数量 die 的良品打墨 (0 表示不启用)")
+	clusterFlag := fs.Int("cluster", 0, "与大于该大小的失效簇相邻的良品打墨 (0 表示不启用)")
+	binFlag := fs.String("bin", "", "打墨 bin 编号 (必填)")
+	goodFlag := fs.String("good", "", "良品 bin 编号，逗号分隔，覆盖映射配置中的设置 (默认数值为 1 的编号)")
+	outFlag := fs.String("o", "", "输出文件夹 (必填)")
+	profileFlag := fs.String("profile", "", "映射配置文件 (JSON)，提供良品 bin 与文件编码")
+	encodingFlag := fs.String("encoding", "", "map 文件编码: auto/utf-8/gbk/utf-16le/utf-16be，覆盖映射配置中的设置")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *binFlag == "" || *outFlag == "" || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "ink 需要 -bin 打墨编号、-o 输出文件夹以及至少一个输入")
+		fs.Usage()
+		return 2
+	}
+	if model.IsPlaceholder(*binFlag) {
+		fmt.Fprintf(os.Stderr, "打墨编号不能是占位符 %s\n", *binFlag)
+		return 2
+	}
+	if *neighborFlag <= 0 && *edgeFlag <= 0 && *clusterFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "请至少启用 -neighbors、-edge、-cluster 中的一条规则")
+		return 2
+	}
+	cfg, err := loadSettings(*profileFlag, *encodingFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *goodFlag != "" {
+		cfg.Profile.GoodBins = splitList(*goodFlag)
+	}
+	opts := analysis.InkOptions{
+		NeighborFails: *neighborFlag,
+		EdgeDistance:  *edgeFlag,
+		ClusterSize:   *clusterFlag,
+		InkBin:        *binFlag,
+		GoodBins:      cfg.Profile.GoodBins,
+	}
+
+	archives := parser.NewArchives()
+	defer archives.Close()
+	files, failed, err := parser.CollectFiles(fs.Args(), archives)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, o := range failed {
+		fmt.Fprintf(os.Stderr, "跳过 %s: %s\n", o.Path, o.Detail)
+	}
+	parserOpts := cfg.Profile.ParserOptions()
+	parserOpts.Archives = archives
+	if err := os.MkdirAll(*outFlag, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "创建输出目录失败: %v\n", err)
+		return 1
+	}
+
+	var results []analysis.InkResult
+	for _, fPath := range files {
+		maps, err := parser.ReadWaferMaps(fPath, parserOpts)
+		if err != nil {
+			if errors.Is(err, model.ErrNoData) {
+				continue // 静默跳过没有数据的文件
+			}
+			fmt.Fprintf(os.Stderr, "解析文件 %s 失败: %v\n", fPath, err)
+			return 1
+		}
+
+		for _, m := range maps {
+			result := analysis.InkWaferMap(m, opts)
+			if err := parser.WriteWaferMap(filepath.Join(*outFlag, report.FileNameStem(m.FileName, m.Block)+"_ink.txt"), result.Map); err != nil {
+				fmt.Fprintf(os.Stderr, "写入打墨 map 失败: %v\n", err)
+				return 1
+			}
+			fmt.Printf("%s-%s: 邻近失效 %d，边缘 %d，失效簇 %d\n", m.Lot, m.Wafer, result.Neighbor, result.Edge, result.Cluster)
+			results = append(results, result)
+		}
+	}
+
+	reportPath := filepath.Join(*outFlag, "ink_report.xlsx")
+	if err := report.WriteInk(reportPath, results); err != nil {
+		fmt.Fprintf(os.Stderr, "写入打墨报告失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已处理 %d 个晶圆，打墨报告: %s\n", len(results), reportPath)
+	return 0
+}
+
+func runGenerateCommand(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	defaults := mapgen.DefaultOptions()
+	outFlag := fs.String("o", "", "输出文件夹 (必填)")
+	lotFlag := fs.String("lot", defaults.Lot, "LOT 号")
+	countFlag := fs.Int("n", 1, "生成的晶圆数量，WAFER 从 01 开始编号")
+	diameterFlag := fs.Float64("diameter", defaults.Diameter, "晶圆直径 (mm)")
+	dieFlag := fs.String("die", "5x5", "die 尺寸 宽x高 (mm)")
+	edgeFlag := fs.Float64("edge", defaults.EdgeExclusion, "边缘排除宽度 (mm)")
+	binsFlag := fs.String("bins", "001:92,005:3,007:2,012:3", "各 bin 的相对权重，格式为 编号:权重，逗号分隔")
+	skipFlag := fs.Float64("skip", 0, "未测试 die (...) 的比例 (0-1)")
+	patternFlag := fs.String("pattern", "", "叠加的失效模式，格式为 模式:bin[:大小[:比例]]，逗号分隔；模式可选 cluster/edge/scratch/center")
+	deviceFlag := fs.String("device", "", "写入 DEVICE 头部的产品名")
+	seedFlag := fs.Uint64("seed", 1, "随机种子，相同参数与种子生成相同的 map")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *outFlag == "" || *countFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "generate 需要 -o 输出文件夹，-n 必须大于 0")
+		fs.Usage()
+		return 2
+	}
+
+	opts := mapgen.Options{Diameter: *diameterFlag, EdgeExclusion: *edgeFlag, SkipRate: *skipFlag}
+	width, height, ok := strings.Cut(*dieFlag, "x")
+	var errW, errH error
+	opts.DieWidth, errW = strconv.ParseFloat(width, 64)
+	opts.DieHeight, errH = strconv.ParseFloat(height, 64)
+	if !ok || errW != nil || errH != nil || opts.DieWidth <= 0 || opts.DieHeight <= 0 {
+		fmt.Fprintf(os.Stderr, "die 尺寸 %q 格式应为 宽x高，如 5x5\n", *dieFlag)
+		return 2
+	}
+	var err error
+	if opts.Bins, err = mapgen.ParseBins(*binsFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if opts.Patterns, err = mapgen.ParsePatterns(*patternFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *deviceFlag != "" {
+		opts.Metadata = map[string]string{"DEVICE": *deviceFlag}
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := os.MkdirAll(*outFlag, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "创建输出目录失败: %v\n", err)
+		return 1
+	}
+
+	// 每片晶圆使用不同的种子，整批结果仍由 -seed 决定
+	for i := 0; i < *countFlag; i++ {
+		opts.Lot = *lotFlag
+		opts.Wafer = fmt.Sprintf("%02d", i+1)
+		opts.Seed = *seedFlag + uint64(i)
+		m, err := mapgen.Generate(opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := parser.WriteWaferMap(filepath.Join(*outFlag, m.FileName), m); err != nil {
+			fmt.Fprintf(os.Stderr, "写入 map 失败: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("已生成 %d 片晶圆，保存在: %s\n", *countFlag, *outFlag)
+	return 0
+}
+
+func runWatchCommand(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	profileFlag := fs.String("profile", "", "映射配置文件 (JSON)，包含名称映射、良品 bin 与 SBL 限值")
+	rulesFlag := fs.String("rules", "", "重判规则文件 (JSON)")
+	outFlag := fs.String("o", "", "输出文件夹，保存每个文件的结果、滚动汇总及已处理台账 (必填)")
+	summaryFlag := fs.String("summary", "", "滚动汇总 Excel 路径 (默认为输出文件夹下的 summary.xlsx)")
+	titleFlag := fs.String("title", "处理结果", "滚动汇总的标题")
+	layoutFlag := fs.String("layout", string(report.LayoutTable), "每片晶圆独立结果的版式: table (与汇总表相同)/horizontal (名称一行、数量一行)")
+	templateFlag := fs.String("template", "", "xlsx 报表模板，指定后每片晶圆的结果及滚动汇总均按模板填充 (见 deviceParser help)")
+	settleFlag := fs.Duration("settle", 2*time.Second, "文件在该时间内没有变化才视为写入完成")
+	dbFlag := fs.String("db", "", "本地数据库路径 (默认位于用户配置目录)")
+	noSaveFlag := fs.Bool("nosave", false, "不将结果保存到本地数据库")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg := newSettings()
+	if *outFlag == "" || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "watch 需要 -o 输出文件夹以及至少一个监视文件夹")
+		fs.Usage()
+		return 2
+	}
+	layout, err := report.ParseLayout(*layoutFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *settleFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "-settle 必须大于 0")
+		return 2
+	}
+	for _, dir := range fs.Args() {
+		if fileInfo, err := os.Stat(dir); err != nil || !fileInfo.IsDir() {
+			fmt.Fprintf(os.Stderr, "%s 不是文件夹\n", dir)
+			return 2
+		}
+	}
+
+	if *profileFlag != "" {
+		profile, err := mapping.LoadProfile(*profileFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		cfg.applyProfile(profile)
+	}
+	if *rulesFlag != "" {
+		rules, err := mapping.LoadRules(*rulesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		cfg.Rules = rules
+	}
+	if *templateFlag != "" {
+		if err := report.CheckTemplate(*templateFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		cfg.Template = *templateFlag
+	}
+
+	w := &folderWatcher{
+		Settings:    cfg,
+		Dirs:        fs.Args(),
+		OutDir:      *outFlag,
+		SummaryPath: *summaryFlag,
+		Title:       *titleFlag,
+		Layout:      layout,
+		Settle:      *settleFlag,
+		DBPath:      *dbFlag,
+		SaveToStore: !*noSaveFlag,
+	}
+	if w.SummaryPath == "" {
+		w.SummaryPath = filepath.Join(*outFlag, "summary.xlsx")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := w.run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runServeCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addrFlag := fs.String("addr", "127.0.0.1:8080", "监听地址")
+	profileFlag := fs.String("profile", "", "请求未指定配置时使用的映射配置文件 (JSON)")
+	profileDirFlag := fs.String("profiles", "", "映射配置保存目录 (默认位于用户配置目录)")
+	rulesFlag := fs.String("rules", "", "重判规则文件 (JSON)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	s := &apiServer{ProfileDir: *profileDirFlag, Defaults: newSettings().Profile}
+	if s.ProfileDir == "" {
+		dir, err := defaultProfileDir()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		s.ProfileDir = dir
+	}
+	if *profileFlag != "" {
+		profile, err := mapping.LoadProfile(*profileFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		s.Defaults = profile
+	}
+	if *rulesFlag != "" {
+		rules, err := mapping.LoadRules(*rulesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		s.Rules = rules
+	}
+
+	server := &http.Server{Addr: *addrFlag, Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	fmt.Printf("HTTP 接口已启动: http://%s ，配置目录: %s\n", *addrFlag, s.ProfileDir)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "HTTP 服务出错: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runValidateCommand(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	quietFlag := fs.Bool("q", false, "只列出错误，不显示警告")
+	encodingFlag := fs.String("encoding", parser.EncodingAuto, "map 文件编码: auto/utf-8/gbk/utf-16le/utf-16be")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := parser.ValidateEncoding(*encodingFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "validate 需要至少一个输入")
+		fs.Usage()
+		return 2
+	}
+
+	archives := parser.NewArchives()
+	defer archives.Close()
+	files, failed, err := parser.CollectFiles(fs.Args(), archives)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// 无法打开的压缩包计为存在错误的文件
+	invalid := len(failed)
+	for _, o := range failed {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", o.Path, o.Detail)
+	}
+	for _, fPath := range files {
+		diags, err := parser.ValidateFile(fPath, parser.Options{Encoding: *encodingFlag, Archives: archives})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", fPath, err)
+			invalid++
+			continue
+		}
+		for _, d := range diags {
+			if *quietFlag && d.Severity != model.SeverityError {
+				continue
+			}
+			d.File = fPath
+			fmt.Println(d)
+		}
+		if model.HasErrors(diags) {
+			invalid++
+		}
+	}
+	fmt.Printf("已校验 %d 个文件，%d 个存在错误\n", len(files)+len(failed), invalid)
+	if invalid > 0 {
+		return 1
+	}
+	return 0
+}
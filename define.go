@@ -2,30 +2,68 @@ package main
 
 import (
 	"embed"
-	"errors"
+	"maps"
+
+	"deviceParser/mapping"
+	"deviceParser/mes"
+	"deviceParser/model"
+	"deviceParser/report"
 )
 
-var (
-	//go:embed rsc/icon.png
-	iconFile embed.FS
+//go:embed rsc/icon.png
+var iconFile embed.FS
 
-	dynamicBinNameMapping = make(map[string]string)
-	defaultPrefix         = "BIN"
+// settings 界面或单次命令使用的映射配置及重判规则，由调用方显式传递
+type settings struct {
+	Profile  mapping.Profile
+	Rules    []mapping.Rule // 用户加载的重判规则，为空时不做重判
+	Template string         // 用户提供的 xlsx 报表模板，为空时使用内置版式
+}
 
-	ErrNoData = errors.New("no data found")
-)
+// newSettings 返回使用默认前缀、没有名称映射的配置
+func newSettings() *settings {
+	return &settings{Profile: mapping.Profile{Prefix: mapping.DefaultPrefix, Names: make(map[string]string)}}
+}
+
+// applyProfile 用加载的映射配置替换当前配置，配置中未设置前缀时保留当前前缀
+func (s *settings) applyProfile(profile mapping.Profile) {
+	prefix := s.Profile.Prefix
+	s.Profile = profile
+	if s.Profile.Prefix == "" {
+		s.Profile.Prefix = prefix
+	}
+	s.Profile.Names = maps.Clone(profile.Names)
+	if s.Profile.Names == nil {
+		s.Profile.Names = make(map[string]string)
+	}
+}
+
+// overrideMESURL 用命令行指定的地址覆盖映射配置中的 MES 上传地址，其余设置保持不变
+func (s *settings) overrideMESURL(url string) error {
+	opts := mes.Options{}
+	if s.Profile.MES != nil {
+		opts = *s.Profile.MES
+	}
+	opts.URL = url
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	s.Profile.MES = &opts
+	return nil
+}
 
-// fileResult holds the parsed data from a single input file.
-type fileResult struct {
-	FileName string
-	Lot      string
-	Wafer    string
-	Counts   map[string]int
+// writeSummary 生成汇总报表，设置了模板时按模板填充 (模板报表不含 Log 工作表)
+func (s *settings) writeSummary(outputFilePath, title string, results []model.FileResult, outcomes []model.FileOutcome) error {
+	if s.Template != "" {
+		return report.WriteTemplate(s.Template, outputFilePath, title, results, s.Profile.BinNames(), s.Profile.GoodBins)
+	}
+	return report.WriteSummary(outputFilePath, title, results, s.Profile.BinNames(), outcomes)
 }
 
-// record 结构体 (保持不变)
-type record struct {
-	name  string
-	key   string
-	count int
+// writeWafer 生成单片晶圆的报表，设置了模板时按模板填充，否则使用所选版式
+func (s *settings) writeWafer(outputFilePath string, result model.FileResult, layout report.Layout) error {
+	if s.Template != "" {
+		return report.WriteTemplate(s.Template, outputFilePath, report.WaferTitle(result), []model.FileResult{result}, s.Profile.BinNames(), s.Profile.GoodBins)
+	}
+	return report.WriteWafer(outputFilePath, result, s.Profile.BinNames(), layout)
 }
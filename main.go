@@ -7,8 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
 	"strings"
-	"time"
 	_ "time/tzdata"
 
 	"fyne.io/fyne/v2"
@@ -19,31 +19,16 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
-)
-
-// 全局状态：用于存储用户动态配置的映射
 
-func nowISO8601() string {
-	loc, _ := time.LoadLocation("Asia/Shanghai")
-	return time.Now().In(loc).Format("2006-01-02T15:04:05Z07:00")
-}
-
-// calculateApproxTextWidth 根据字符串内容估算其在Excel中的显示宽度
-func calculateApproxTextWidth(text string) float64 {
-	// 这是一个启发式计算：
-	// ASCII字符（数字、字母、英文符号）宽度计为 1
-	// 其他字符（如中文）宽度计为 2
-	// 最后增加一些内边距
-	width := 0.0
-	for _, r := range text {
-		if r <= 127 { // Is ASCII
-			width += 1.0
-		} else {
-			width += 2.0
-		}
-	}
-	return width + 3.0 // 增加 3 个字符的内边距，使显示效果更好
-}
+	"deviceParser/analysis"
+	"deviceParser/mapping"
+	"deviceParser/mes"
+	"deviceParser/model"
+	"deviceParser/parser"
+	"deviceParser/report"
+	"deviceParser/spc"
+	"deviceParser/store"
+)
 
 func resizeDialog(d dialog.Dialog, parent fyne.Window) {
 	const minWidth float32 = 600
@@ -64,6 +49,19 @@ func resizeDialog(d dialog.Dialog, parent fyne.Window) {
 	d.Resize(fyne.NewSize(targetWidth, targetHeight))
 }
 
+// parseOptionalInt 解析可留空的非负整数输入，留空时返回 0
+func parseOptionalInt(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q 不是非负整数", text)
+	}
+	return n, nil
+}
+
 func handleCrash() {
 	if r := recover(); r != nil {
 		// 记录崩溃信息到文件
@@ -76,6 +74,14 @@ func handleCrash() {
 func main() {
 	defer handleCrash()
 
+	// 带子命令启动时以命令行模式运行 (macOS 从 Finder 启动时会附带 -psn_ 参数，需要忽略)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-psn_") {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	// 界面中的映射配置、前缀及重判规则，各按钮共用
+	cfg := newSettings()
+
 	myApp := app.NewWithID("com.codingwang.deviceParser.v1")
 	data, err := iconFile.ReadFile("rsc/icon.png")
 	if err != nil {
@@ -100,13 +106,23 @@ func main() {
 	summaryFileNameEntry := widget.NewEntry()
 	summaryFileNameEntry.SetPlaceHolder("请输入汇总文件名 (如: summary_report)")
 	summaryFileNameEntry.Hide() // 默认隐藏
+	// 独立文件模式下单片晶圆报表的版式，标题由 LOT/WAFER 生成
+	var layoutOptions []string
+	for _, item := range report.LayoutLabels {
+		layoutOptions = append(layoutOptions, item.Label)
+	}
+	layoutSelect := widget.NewSelect(layoutOptions, nil)
+	layoutSelect.SetSelected(layoutOptions[0])
+	layoutRow := container.NewBorder(nil, nil, widget.NewLabel("单文件版式:"), nil, layoutSelect)
 	summarizeCheck.OnChanged = func(checked bool) {
 		if checked {
 			summaryFileNameEntry.Show()
 			summaryFileNameEntry.Enable()
+			layoutRow.Hide()
 		} else {
 			summaryFileNameEntry.Hide()
 			summaryFileNameEntry.Disable()
+			layoutRow.Show()
 		}
 	}
 
@@ -127,10 +143,14 @@ func main() {
 			// 每次选择都清空旧的，确保只处理一种模式
 			itemListBinding.Set([]string{})
 			itemListBinding.Append(reader.URI().Path())
-			statusLabel.SetText("模式: 单文件处理")
+			if parser.IsArchive(reader.URI().Path()) {
+				statusLabel.SetText("模式: 压缩包处理")
+			} else {
+				statusLabel.SetText("模式: 单文件处理")
+			}
 		}, mainWindow)
 		// ... dialog setup ...
-		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".txt"}))
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".txt", ".zip", ".gz"}))
 		resizeDialog(fileDialog, mainWindow)
 		fileDialog.Show()
 	})
@@ -184,20 +204,160 @@ func main() {
 
 	// 修改前缀输入框和按钮
 	prefixEntry := widget.NewEntry()
-	prefixEntry.SetText("BIN")
+	prefixEntry.SetText(cfg.Profile.Prefix)
 	prefixChangeButton := widget.NewButton("修改前缀", func() {
 		// 根据输入的文本作为默认前缀
-		defaultPrefix = prefixEntry.Text
+		cfg.Profile.Prefix = prefixEntry.Text
 		dialog.ShowInformation("提示", "前缀修改成功", mainWindow)
 	})
 	prefixChangeButton.Importance = widget.MediumImportance
 
+	// 重判规则：加载 JSON 规则文件，在提取数据之后、写入报表之前应用
+	rebinRulesLabel := widget.NewLabel("未加载")
+	rebinMapCheck := widget.NewCheck("同时输出重判后的 map 文件", nil)
+	rebinButton := widget.NewButton("加载重判规则", func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			rules, err := mapping.LoadRules(reader.URI().Path())
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			cfg.Rules = rules
+			rebinRulesLabel.SetText(fmt.Sprintf("%s (%d 条规则)", reader.URI().Name(), len(rules)))
+		}, mainWindow)
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+		resizeDialog(fileDialog, mainWindow)
+		fileDialog.Show()
+	})
+	rebinButton.Importance = widget.MediumImportance
+
+	// 报表模板：用户提供的 xlsx 模板，选择后汇总及独立文件均按模板填充占位符
+	templateLabel := widget.NewLabel("未使用 (内置版式)")
+	templateButton := widget.NewButton("选择模板", func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			reader.Close()
+
+			if err := report.CheckTemplate(reader.URI().Path()); err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			cfg.Template = reader.URI().Path()
+			templateLabel.SetText(reader.URI().Name())
+		}, mainWindow)
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".xlsx"}))
+		resizeDialog(fileDialog, mainWindow)
+		fileDialog.Show()
+	})
+	templateButton.Importance = widget.MediumImportance
+	templateClearButton := widget.NewButton("清除", func() {
+		cfg.Template = ""
+		templateLabel.SetText("未使用 (内置版式)")
+	})
+	templateHelpButton := widget.NewButton("占位符", func() {
+		dialog.ShowInformation("报表模板占位符", report.TemplateHelp, mainWindow)
+	})
+
+	// 失效簇分析：在汇总表中追加簇统计，超过阈值的晶圆标红
+	clusterCheck := widget.NewCheck("失效簇分析", nil)
+	connectivitySelect := widget.NewSelect([]string{"4 连通", "8 连通"}, nil)
+	connectivitySelect.SetSelected("8 连通")
+	clusterBinsEntry := widget.NewEntry()
+	clusterBinsEntry.SetPlaceHolder("参与分析的 bin，逗号分隔 (默认全部失效 bin)")
+	maxClustersEntry := widget.NewEntry()
+	maxClustersEntry.SetPlaceHolder("簇数量上限")
+	maxClusterSizeEntry := widget.NewEntry()
+	maxClusterSizeEntry.SetPlaceHolder("最大簇上限")
+
+	// 严格校验：存在错误级别问题 (如无法识别的 token、LOT 前后不一致) 的文件不参与汇总
+	strictCheck := widget.NewCheck("严格校验 (拒绝存在错误的文件)", nil)
+
+	// 同一批次中 LOT、WAFER 相同的文件的处理方式
+	var duplicateOptions []string
+	for _, item := range analysis.DuplicatePolicyLabels {
+		duplicateOptions = append(duplicateOptions, item.Label)
+	}
+	duplicateSelect := widget.NewSelect(duplicateOptions, nil)
+	duplicateSelect.SetSelected(duplicateOptions[0])
+
 	// 配置映射按钮
 	configButton := widget.NewButton("配置映射关系", func() {
-		configButtonClickHandler(itemListBinding, mainWindow, myApp)
+		configButtonClickHandler(itemListBinding, mainWindow, myApp, cfg)
 	})
 	configButton.Importance = widget.MediumImportance
 
+	// 历史查询按钮
+	historyButton := widget.NewButton("历史查询", func() {
+		showHistoryWindow(myApp, cfg)
+	})
+	historyButton.Importance = widget.MediumImportance
+	saveToStoreCheck := widget.NewCheck("保存结果到本地数据库", nil)
+	saveToStoreCheck.SetChecked(true)
+
+	// 加载/保存映射配置 (名称映射、前缀、良品 bin 与 SBL 限值)
+	loadProfileButton := widget.NewButton("加载配置", func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			profile, err := mapping.LoadProfile(reader.URI().Path())
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			cfg.applyProfile(profile)
+			prefixEntry.SetText(cfg.Profile.Prefix)
+			dialog.ShowInformation("提示", fmt.Sprintf("已加载 %d 个名称映射、%d 个 bin 限值", len(profile.Names), len(profile.BinLimits)), mainWindow)
+		}, mainWindow)
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+		resizeDialog(fileDialog, mainWindow)
+		fileDialog.Show()
+	})
+	loadProfileButton.Importance = widget.MediumImportance
+	saveProfileButton := widget.NewButton("保存配置", func() {
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			writer.Close()
+
+			if err := mapping.SaveProfile(writer.URI().Path(), cfg.Profile); err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
+			}
+			dialog.ShowInformation("提示", "配置保存成功", mainWindow)
+		}, mainWindow)
+		fileDialog.SetFileName("profile.json")
+		resizeDialog(fileDialog, mainWindow)
+		fileDialog.Show()
+	})
+	saveProfileButton.Importance = widget.MediumImportance
+
 	// “开始处理”按钮的逻辑 (基本不变)
 	processButton := widget.NewButton("开始处理", func() {
 		items, _ := itemListBinding.Get()
@@ -216,18 +376,19 @@ func main() {
 		}
 
 		var filesToProcess []string
+		var failed []model.FileOutcome // 无法打开的压缩包
 		var finalOutputDir string
+		archives := parser.NewArchives()
+		defer archives.Close()
 
 		// --- 根据输入是文件还是文件夹，决定处理列表和最终输出目录 ---
-		if fileInfo.IsDir() {
+		// 压缩包按文件夹处理，处理其中的全部 .txt 文件
+		if fileInfo.IsDir() || parser.IsArchive(inputPath) {
 			// 模式: 文件夹
-			entries, err := os.ReadDir(inputPath)
-			if err != nil { /* ... error handling ... */
-			}
-			for _, entry := range entries {
-				if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".txt") {
-					filesToProcess = append(filesToProcess, filepath.Join(inputPath, entry.Name()))
-				}
+			filesToProcess, failed, err = parser.CollectFiles([]string{inputPath}, archives)
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+				return
 			}
 			// 创建新的子文件夹作为输出目录
 			newFolderName := fmt.Sprintf("%s_results", filepath.Base(inputPath))
@@ -244,28 +405,134 @@ func main() {
 			return
 		}
 
+		clusterOpts := analysis.ClusterOptions{Connectivity: 8, Bins: splitList(clusterBinsEntry.Text), GoodBins: cfg.Profile.GoodBins}
+		if connectivitySelect.Selected == "4 连通" {
+			clusterOpts.Connectivity = 4
+		}
+		if clusterOpts.MaxClusters, err = parseOptionalInt(maxClustersEntry.Text); err != nil {
+			dialog.ShowError(fmt.Errorf("簇数量上限无效: %w", err), mainWindow)
+			return
+		}
+		if clusterOpts.MaxClusterSize, err = parseOptionalInt(maxClusterSizeEntry.Text); err != nil {
+			dialog.ShowError(fmt.Errorf("最大簇上限无效: %w", err), mainWindow)
+			return
+		}
+
 		statusLabel.SetText(fmt.Sprintf("开始处理 %d 个文件...", len(filesToProcess)))
 
 		// --- 数据提取循环 ---
-		var results []fileResult
+		// 单个文件出错不影响其余文件，每个文件的结果记录在 outcomes 中，处理完成后统一展示
+		parserOpts := cfg.Profile.ParserOptions()
+		parserOpts.Strict = strictCheck.Checked
+		parserOpts.Archives = archives
+		var results []model.FileResult
+		outcomes := failed
 		for i, fPath := range filesToProcess {
 			statusLabel.SetText(fmt.Sprintf("正在提取数据: %d/%d", i+1, len(filesToProcess)))
-			result, err := extractDataFromFile(fPath)
+			fileResults, outcome, err := parser.Extract(fPath, parserOpts)
 			if err != nil {
-				if errors.Is(err, ErrNoData) {
-					continue // 静默跳过没有数据的文件
+				outcomes = append(outcomes, outcome)
+				continue
+			}
+
+			// 重判 map 输出与失效簇分析都需要完整的网格，多晶圆文件每片晶圆一个网格
+			writeRebinMap := rebinMapCheck.Checked && len(cfg.Rules) > 0
+			var maps []model.WaferMap
+			if writeRebinMap || clusterCheck.Checked {
+				maps, err = parser.ReadWaferMaps(fPath, parserOpts)
+				if err == nil && len(maps) != len(fileResults) {
+					err = fmt.Errorf("网格中有 %d 片晶圆，应为 %d", len(maps), len(fileResults))
+				}
+				if err != nil {
+					outcome.Fail(fmt.Errorf("读取 map 失败: %w", err))
+					outcomes = append(outcomes, outcome)
+					continue
 				}
-				dialog.ShowError(fmt.Errorf("意外错误: %w", err), mainWindow)
-				return
 			}
-			results = append(results, result)
+
+			for j, result := range fileResults {
+				result = mapping.RebinCounts(cfg.Rules, result)
+				if maps != nil {
+					m := mapping.RebinWaferMap(cfg.Rules, maps[j])
+					if writeRebinMap {
+						rebinPath := filepath.Join(finalOutputDir, fmt.Sprintf("%s_rebin.txt", report.FileNameStem(m.FileName, m.Block)))
+						if err := parser.WriteWaferMap(rebinPath, m); err != nil {
+							dialog.ShowError(fmt.Errorf("写入重判 map 失败: %w", err), mainWindow)
+							return
+						}
+					}
+					if clusterCheck.Checked {
+						summary := analysis.AnalyzeClusters(m, clusterOpts)
+						result.Clusters = &summary
+					}
+				}
+				results = append(results, result)
+			}
+			outcomes = append(outcomes, outcome)
 		}
 
 		if len(results) == 0 {
+			statusLabel.SetText(model.OutcomeSummary(outcomes))
+			showOutcomeWindow(myApp, outcomes)
 			dialog.ShowInformation("提示", "所有文件中都没有提取到有效数据。", mainWindow)
 			return
 		}
 
+		// 重复的 LOT-WAFER 按所选策略处理，并在完成提示中列出
+		dedupe := analysis.DedupeOptions{Policy: analysis.DuplicatePolicyLabels[duplicateSelect.SelectedIndex()].Policy, Rules: cfg.Rules, GoodBins: cfg.Profile.GoodBins, Parser: parserOpts}
+		if clusterCheck.Checked {
+			dedupe.Clusters = &clusterOpts
+		}
+		results, duplicates, err := analysis.ResolveDuplicates(results, dedupe)
+		if err != nil {
+			dialog.ShowError(err, mainWindow)
+			return
+		}
+
+		// SBL 与 SPC 检查，超限的单元格会在 Excel 中标红并列入 Alarms 工作表
+		mapping.ApplyLimits(results, cfg.Profile.Limits(), cfg.Profile.GoodBins)
+		if cfg.Profile.SPC != nil {
+			if err := spc.Run(results, cfg.Profile.Product, *cfg.Profile.SPC, cfg.Profile.GoodBins); err != nil {
+				dialog.ShowError(fmt.Errorf("SPC 检查失败: %w", err), mainWindow)
+				return
+			}
+		}
+		violating := model.CountViolating(results)
+
+		// 保存到本地数据库失败不影响生成报表，仅提示用户
+		if saveToStoreCheck.Checked {
+			if err := store.SaveResults("", results, cfg.Profile.Product); err != nil {
+				dialog.ShowError(err, mainWindow)
+			}
+		}
+		alarmNote := "\n" + model.OutcomeSummary(outcomes)
+		if violating > 0 {
+			alarmNote += fmt.Sprintf("\n注意: %d 个晶圆超出限值，详见 Alarms 工作表", violating)
+		}
+		if len(duplicates) > 0 {
+			alarmNote += fmt.Sprintf("\n注意: %d 组重复的扩散批号:", len(duplicates))
+			for i, group := range duplicates {
+				if i == 10 {
+					alarmNote += fmt.Sprintf("\n  ... 共 %d 组", len(duplicates))
+					break
+				}
+				alarmNote += "\n  " + group.String()
+			}
+		}
+
+		// 报表写入后上传到 MES，失败的记录保存在待发送目录中，下次运行时补发
+		pushToMES := func() string {
+			if cfg.Profile.MES == nil {
+				return ""
+			}
+			statusLabel.SetText("正在上传到 MES...")
+			mesReport, err := mes.Push(results, cfg.Profile.Product, *cfg.Profile.MES, cfg.Profile.GoodBins)
+			if err != nil {
+				dialog.ShowError(err, mainWindow)
+			}
+			return mesReport.Note()
+		}
+
 		// 结果标题
 		title := "处理结果"
 
@@ -285,14 +552,16 @@ func main() {
 			outputFilePath := filepath.Join(outputRootPath, fmt.Sprintf("%s", summaryFileName))
 
 			// 写入Excel
-			err := writeToExcel(outputFilePath, title, results, dynamicBinNameMapping, defaultPrefix)
+			err := cfg.writeSummary(outputFilePath, title, results, outcomes)
 			if err != nil {
 				dialog.ShowError(fmt.Errorf("写入汇总文件失败: %w", err), mainWindow)
 				return
 			}
 
+			mesNote := pushToMES()
 			statusLabel.SetText("汇总处理完成！")
-			dialog.ShowInformation("成功", fmt.Sprintf("所有文件已汇总处理完毕！\n结果保存在: %s", outputFilePath), mainWindow)
+			showOutcomeWindow(myApp, outcomes)
+			dialog.ShowInformation("成功", fmt.Sprintf("所有文件已汇总处理完毕！\n结果保存在: %s%s%s", outputFilePath, alarmNote, mesNote), mainWindow)
 		} else {
 			// ******************************************************
 			// *** 模式: 独立文件 (这是您需要补充完整的部分) ***
@@ -302,14 +571,13 @@ func main() {
 			for i, result := range results {
 				statusLabel.SetText(fmt.Sprintf("正在处理: %d/%d", i+1, len(results)))
 
-				fileNameNoExt := strings.TrimSuffix(result.FileName, filepath.Ext(result.FileName))
-				outFileName := fmt.Sprintf("%s_result.xlsx", fileNameNoExt)
+				outFileName := fmt.Sprintf("%s_result.xlsx", report.FileNameStem(result.FileName, result.Block))
 				outFilePath := filepath.Join(finalOutputDir, outFileName)
 
-				// 每次调用写入函数时，只传入包含当前文件结果的切片
-				err := writeToExcel(outFilePath, title, []fileResult{result}, dynamicBinNameMapping, defaultPrefix)
+				// 每片晶圆单独一个文件，按模板或所选版式写入
+				err := cfg.writeWafer(outFilePath, result, report.LayoutLabels[layoutSelect.SelectedIndex()].Layout)
 				if err != nil {
-					if errors.Is(err, ErrNoData) {
+					if errors.Is(err, model.ErrNoData) {
 						dialog.ShowError(fmt.Errorf("写入文件失败: %w", err), mainWindow)
 						continue // 静默跳过没有数据的文件
 					}
@@ -318,8 +586,10 @@ func main() {
 				}
 			}
 
+			mesNote := pushToMES()
 			statusLabel.SetText(fmt.Sprintf("处理完成！共 %d 个文件。", len(results)))
-			dialog.ShowInformation("成功", fmt.Sprintf("所有 %d 个文件已独立处理完毕！\n结果保存在: %s", len(results), finalOutputDir), mainWindow)
+			showOutcomeWindow(myApp, outcomes)
+			dialog.ShowInformation("成功", fmt.Sprintf("所有 %d 个文件已独立处理完毕！\n结果保存在: %s%s%s", len(results), finalOutputDir, alarmNote, mesNote), mainWindow)
 		}
 	})
 	processButton.Importance = widget.HighImportance
@@ -336,9 +606,19 @@ func main() {
 		itemListWidget,
 		summarizeCheck,
 		summaryFileNameEntry,
+		layoutRow,
+		rebinMapCheck,
+		strictCheck,
+		container.NewBorder(nil, nil, widget.NewLabel("重复晶圆:"), nil, duplicateSelect),
+		container.NewBorder(nil, nil, container.NewHBox(clusterCheck, connectivitySelect), nil,
+			container.New(layout.NewGridLayout(3), clusterBinsEntry, maxClustersEntry, maxClusterSizeEntry)),
 		container.NewBorder(nil, nil, widget.NewLabel("输出文件夹："), selectOutputFolderButton, outputFolderEntry),
 		container.NewBorder(nil, nil, widget.NewLabel("默认前缀:"), prefixChangeButton, prefixEntry),
-		container.New(layout.NewGridLayout(2), configButton, processButton),
+		container.NewBorder(nil, nil, widget.NewLabel("重判规则:"), rebinButton, rebinRulesLabel),
+		container.NewBorder(nil, nil, widget.NewLabel("报表模板:"), container.NewHBox(templateButton, templateClearButton, templateHelpButton), templateLabel),
+		saveToStoreCheck,
+		container.New(layout.NewGridLayout(4), configButton, loadProfileButton, saveProfileButton, historyButton),
+		processButton,
 		statusLabel,
 	)
 
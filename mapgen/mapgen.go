@@ -0,0 +1,351 @@
+// Package mapgen 生成合成的 RowData 晶圆 map：按晶圆直径与 die 尺寸排布圆形网格，按 bin 分布随机填充，
+// 并叠加团状、边缘、划痕、中心等常见的空间失效模式，用于演示、压力测试以及模糊测试的种子
+package mapgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"deviceParser/model"
+)
+
+// PatternKind 空间失效模式
+type PatternKind string
+
+const (
+	PatternCluster PatternKind = "cluster" // 随机位置的团状失效
+	PatternEdge    PatternKind = "edge"    // 沿晶圆边缘一圈的失效
+	PatternScratch PatternKind = "scratch" // 以随机角度穿过晶圆的直线划痕
+	PatternCenter  PatternKind = "center"  // 晶圆中心区域的失效
+)
+
+// defaultSizes 各模式未指定大小时使用的默认值 (以 die 为单位)
+var defaultSizes = map[PatternKind]float64{
+	PatternCluster: 3,
+	PatternEdge:    1,
+	PatternScratch: 1,
+	PatternCenter:  4,
+}
+
+// Pattern 叠加在随机分布之上的一种空间失效模式
+type Pattern struct {
+	Kind    PatternKind
+	Bin     string  // 模式区域内失效 die 写入的 bin 编号
+	Size    float64 // 以 die 为单位：cluster、center 为半径，edge 为到有效边缘的宽度，scratch 为线宽；为 0 时使用默认值
+	Density float64 // 模式区域内失效 die 的比例 (0-1]，为 0 时全部失效
+}
+
+// Options 生成参数，零值字段使用 DefaultOptions 中的值
+type Options struct {
+	Lot      string
+	Wafer    string
+	Metadata map[string]string // 写在 LOT/WAFER 之后的其余头部信息，如 DEVICE、TEST DATE
+
+	Diameter      float64 // 晶圆直径 (mm)
+	DieWidth      float64 // die 宽度 (mm)
+	DieHeight     float64 // die 高度 (mm)
+	EdgeExclusion float64 // 边缘排除宽度 (mm)，该范围内不放置 die
+
+	Bins     map[string]float64 // 各 bin 的相对权重 (含良品 bin)
+	SkipRate float64            // 有 die 但没有测试结果 (...) 的比例
+	Patterns []Pattern
+	Seed     uint64 // 相同参数与种子总是生成相同的 map
+}
+
+// DefaultOptions 返回 200mm 晶圆、5mm x 5mm die、良率约 92% 的生成参数
+func DefaultOptions() Options {
+	return Options{
+		Lot:           "SYN0001",
+		Wafer:         "01",
+		Diameter:      200,
+		DieWidth:      5,
+		DieHeight:     5,
+		EdgeExclusion: 3,
+		Bins:          map[string]float64{"001": 92, "005": 3, "007": 2, "012": 3},
+	}
+}
+
+// withDefaults 用默认值补齐零值字段
+func (o Options) withDefaults() Options {
+	d := DefaultOptions()
+	if o.Lot == "" {
+		o.Lot = d.Lot
+	}
+	if o.Wafer == "" {
+		o.Wafer = d.Wafer
+	}
+	if o.Diameter == 0 {
+		o.Diameter = d.Diameter
+	}
+	if o.DieWidth == 0 {
+		o.DieWidth = d.DieWidth
+	}
+	if o.DieHeight == 0 {
+		o.DieHeight = d.DieHeight
+	}
+	if len(o.Bins) == 0 {
+		o.Bins = d.Bins
+	}
+	return o
+}
+
+// Validate 检查生成参数
+func (o Options) Validate() error {
+	o = o.withDefaults()
+	if o.Diameter < 0 || o.DieWidth < 0 || o.DieHeight < 0 || o.EdgeExclusion < 0 {
+		return fmt.Errorf("晶圆直径、die 尺寸及边缘排除宽度不能为负数")
+	}
+	if o.DieWidth > o.Diameter || o.DieHeight > o.Diameter {
+		return fmt.Errorf("die 尺寸 %gx%g 超过晶圆直径 %g", o.DieWidth, o.DieHeight, o.Diameter)
+	}
+	if 2*o.EdgeExclusion >= o.Diameter {
+		return fmt.Errorf("边缘排除宽度 %g 过大", o.EdgeExclusion)
+	}
+	if o.SkipRate < 0 || o.SkipRate > 1 {
+		return fmt.Errorf("未测试比例 %g 超出 0-1 范围", o.SkipRate)
+	}
+	total := 0.0
+	for code, w := range o.Bins {
+		if err := validateBin(code); err != nil {
+			return err
+		}
+		if w < 0 {
+			return fmt.Errorf("bin %s 的权重不能为负数", code)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("bin 权重之和必须大于 0")
+	}
+	for _, p := range o.Patterns {
+		if _, ok := defaultSizes[p.Kind]; !ok {
+			return fmt.Errorf("未知的失效模式: %s (可选 cluster/edge/scratch/center)", p.Kind)
+		}
+		if err := validateBin(p.Bin); err != nil {
+			return err
+		}
+		if p.Size < 0 || p.Density < 0 || p.Density > 1 {
+			return fmt.Errorf("失效模式 %s 的大小或比例无效", p.Kind)
+		}
+	}
+	return nil
+}
+
+// validateBin bin 编号只能由字母或数字组成，与解析时的规则一致
+func validateBin(code string) error {
+	if code == "" || strings.IndexFunc(code, func(r rune) bool {
+		return !('0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	}) >= 0 {
+		return fmt.Errorf("bin 编号 %q 只能包含字母或数字", code)
+	}
+	return nil
+}
+
+// die 网格中一个位置相对晶圆中心的坐标 (mm)
+type die struct {
+	row, col int
+	x, y     float64
+	outer    float64 // 离晶圆中心最远的角到中心的距离
+}
+
+// Generate 生成一片晶圆的 map，没有 die 的位置为 ___，未测试的 die 为 ...
+func Generate(opts Options) (model.WaferMap, error) {
+	if err := opts.Validate(); err != nil {
+		return model.WaferMap{}, err
+	}
+	opts = opts.withDefaults()
+	rng := rand.New(rand.NewPCG(opts.Seed, 0x9e3779b97f4a7c15))
+
+	radius := opts.Diameter/2 - opts.EdgeExclusion
+	cols := int(opts.Diameter / opts.DieWidth)
+	rows := int(opts.Diameter / opts.DieHeight)
+	grid := make([][]string, rows)
+	var dies []die
+	for r := range grid {
+		grid[r] = make([]string, cols)
+		y := (float64(r) - float64(rows-1)/2) * opts.DieHeight
+		for c := range grid[r] {
+			x := (float64(c) - float64(cols-1)/2) * opts.DieWidth
+			// die 的四个角都在有效半径内才放置
+			outer := math.Hypot(math.Abs(x)+opts.DieWidth/2, math.Abs(y)+opts.DieHeight/2)
+			if outer > radius {
+				grid[r][c] = model.EmptyDie
+				continue
+			}
+			dies = append(dies, die{row: r, col: c, x: x, y: y, outer: outer})
+		}
+	}
+	if len(dies) == 0 {
+		return model.WaferMap{}, fmt.Errorf("晶圆上放不下任何 die")
+	}
+
+	pick := newBinPicker(opts.Bins)
+	for _, d := range dies {
+		grid[d.row][d.col] = pick(rng)
+	}
+	dieSize := math.Max(opts.DieWidth, opts.DieHeight)
+	for _, p := range opts.Patterns {
+		applyPattern(grid, dies, p, radius, dieSize, rng)
+	}
+	if opts.SkipRate > 0 {
+		for _, d := range dies {
+			if rng.Float64() < opts.SkipRate {
+				grid[d.row][d.col] = model.SkippedDie
+			}
+		}
+	}
+
+	grid = trimEmpty(grid)
+	header := []string{"LOT: " + opts.Lot, "WAFER: " + opts.Wafer}
+	keys := make([]string, 0, len(opts.Metadata))
+	for k := range opts.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		header = append(header, k+": "+opts.Metadata[k])
+	}
+	return model.WaferMap{
+		FileName: fmt.Sprintf("%s-%s.txt", opts.Lot, opts.Wafer),
+		Lot:      opts.Lot,
+		Wafer:    opts.Wafer,
+		Rows:     grid,
+		Header:   header,
+	}, nil
+}
+
+// newBinPicker 按权重随机选择 bin，编号排序后累加权重，保证同一种子的结果稳定
+func newBinPicker(bins map[string]float64) func(*rand.Rand) string {
+	codes := make([]string, 0, len(bins))
+	for code, w := range bins {
+		if w > 0 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	cumulative := make([]float64, len(codes))
+	total := 0.0
+	for i, code := range codes {
+		total += bins[code]
+		cumulative[i] = total
+	}
+	return func(rng *rand.Rand) string {
+		v := rng.Float64() * total
+		i := sort.SearchFloat64s(cumulative, v)
+		if i == len(codes) {
+			i--
+		}
+		return codes[i]
+	}
+}
+
+// applyPattern 将模式区域内的 die 按 Density 改为模式的 bin
+func applyPattern(grid [][]string, dies []die, p Pattern, radius, dieSize float64, rng *rand.Rand) {
+	size := p.Size
+	if size == 0 {
+		size = defaultSizes[p.Kind]
+	}
+	size *= dieSize
+	density := p.Density
+	if density == 0 {
+		density = 1
+	}
+
+	var inside func(d die) bool
+	switch p.Kind {
+	case PatternCluster:
+		center := dies[rng.IntN(len(dies))]
+		inside = func(d die) bool { return math.Hypot(d.x-center.x, d.y-center.y) <= size }
+	case PatternEdge:
+		inside = func(d die) bool { return radius-d.outer < size }
+	case PatternScratch:
+		// 过随机一点、随机角度的直线，到直线距离不超过半个线宽的 die 视为划痕
+		through := dies[rng.IntN(len(dies))]
+		angle := rng.Float64() * math.Pi
+		nx, ny := -math.Sin(angle), math.Cos(angle)
+		inside = func(d die) bool { return math.Abs((d.x-through.x)*nx+(d.y-through.y)*ny) <= size/2 }
+	case PatternCenter:
+		inside = func(d die) bool { return math.Hypot(d.x, d.y) <= size }
+	}
+	for _, d := range dies {
+		if inside(d) && (density >= 1 || rng.Float64() < density) {
+			grid[d.row][d.col] = p.Bin
+		}
+	}
+}
+
+// trimEmpty 去掉四周全部为空的行和列
+func trimEmpty(grid [][]string) [][]string {
+	first, last := len(grid), -1
+	left, right := len(grid[0]), -1
+	for r, row := range grid {
+		for c, token := range row {
+			if token == model.EmptyDie {
+				continue
+			}
+			first, last = min(first, r), max(last, r)
+			left, right = min(left, c), max(right, c)
+		}
+	}
+	trimmed := grid[first : last+1]
+	for r := range trimmed {
+		trimmed[r] = trimmed[r][left : right+1]
+	}
+	return trimmed
+}
+
+// ParseBins 解析 "001:92,005:3" 形式的 bin 权重
+func ParseBins(s string) (map[string]float64, error) {
+	bins := make(map[string]float64)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		code, weight, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("bin 权重 %q 格式应为 编号:权重", item)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bin %s 的权重 %q 无效", code, weight)
+		}
+		bins[strings.TrimSpace(code)] = w
+	}
+	return bins, nil
+}
+
+// ParsePatterns 解析逗号分隔的失效模式，每项为 模式:bin[:大小[:比例]]，如 "cluster:005:4,edge:012:1:0.5"
+func ParsePatterns(s string) ([]Pattern, error) {
+	var patterns []Pattern
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("失效模式 %q 格式应为 模式:bin[:大小[:比例]]", item)
+		}
+		p := Pattern{Kind: PatternKind(parts[0]), Bin: parts[1]}
+		if _, ok := defaultSizes[p.Kind]; !ok {
+			return nil, fmt.Errorf("未知的失效模式: %s (可选 cluster/edge/scratch/center)", p.Kind)
+		}
+		for i, dst := range []*float64{&p.Size, &p.Density} {
+			if len(parts) <= i+2 {
+				break
+			}
+			v, err := strconv.ParseFloat(parts[i+2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("失效模式 %q 中的数值无效", item)
+			}
+			*dst = v
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
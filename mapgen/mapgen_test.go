@@ -0,0 +1,168 @@
+package mapgen
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"deviceParser/model"
+)
+
+func TestGenerateGeometry(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Seed = 7
+	m, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Lot != "SYN0001" || m.Wafer != "01" || m.FileName != "SYN0001-01.txt" {
+		t.Errorf("header = %q %q %q", m.Lot, m.Wafer, m.FileName)
+	}
+
+	// 网格左右、上下对称，四个角没有 die，每行列数相同
+	width := len(m.Rows[0])
+	dies := 0
+	for r, row := range m.Rows {
+		if len(row) != width {
+			t.Fatalf("row %d has %d columns, want %d", r, len(row), width)
+		}
+		mirror := m.Rows[len(m.Rows)-1-r]
+		for c, token := range row {
+			if (token == model.EmptyDie) != (row[width-1-c] == model.EmptyDie) || (token == model.EmptyDie) != (mirror[c] == model.EmptyDie) {
+				t.Fatalf("grid is not symmetric at %d,%d", r, c)
+			}
+			if token != model.EmptyDie {
+				dies++
+			}
+		}
+	}
+	if m.Rows[0][0] != model.EmptyDie || m.Rows[len(m.Rows)-1][width-1] != model.EmptyDie {
+		t.Error("corners should be empty")
+	}
+
+	// die 数量接近有效面积 / die 面积
+	radius := opts.Diameter/2 - opts.EdgeExclusion
+	approx := math.Pi * radius * radius / (opts.DieWidth * opts.DieHeight)
+	if float64(dies) < approx*0.8 || float64(dies) > approx {
+		t.Errorf("dies = %d, want about %.0f", dies, approx)
+	}
+
+	// 按权重分布，良品约占 92%
+	counts := m.Counts()
+	if yield := float64(counts["001"]) / float64(dies); yield < 0.85 || yield > 0.97 {
+		t.Errorf("yield = %.3f, want about 0.92", yield)
+	}
+	for code := range counts {
+		if _, ok := opts.Bins[code]; !ok {
+			t.Errorf("unexpected bin %s", code)
+		}
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Seed = 42
+	opts.SkipRate = 0.05
+	opts.Patterns = []Pattern{{Kind: PatternCluster, Bin: "050"}, {Kind: PatternScratch, Bin: "060"}}
+	a, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Generate(opts)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("same seed produced different maps")
+	}
+	opts.Seed = 43
+	c, _ := Generate(opts)
+	if reflect.DeepEqual(a.Rows, c.Rows) {
+		t.Error("different seeds produced identical maps")
+	}
+	for _, code := range []string{"050", "060", model.SkippedDie} {
+		found := false
+		for _, row := range a.Rows {
+			for _, token := range row {
+				found = found || token == code
+			}
+		}
+		if !found {
+			t.Errorf("%s not present in map", code)
+		}
+	}
+}
+
+func TestGeneratePatterns(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Diameter = 100
+	opts.Bins = map[string]float64{"001": 1}
+	opts.Patterns = []Pattern{{Kind: PatternEdge, Bin: "012"}, {Kind: PatternCenter, Bin: "020", Size: 2}}
+	m, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 边缘模式：每行最外侧的 die 都是 012
+	for r, row := range m.Rows {
+		first, last := -1, -1
+		for c, token := range row {
+			if token != model.EmptyDie {
+				if first < 0 {
+					first = c
+				}
+				last = c
+			}
+		}
+		if first >= 0 && (row[first] != "012" || row[last] != "012") {
+			t.Errorf("row %d edge = %s/%s, want 012", r, row[first], row[last])
+		}
+	}
+	// 中心模式：中心位置为 020
+	if got := m.Rows[len(m.Rows)/2][len(m.Rows[0])/2]; got != "020" {
+		t.Errorf("center = %s, want 020", got)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for _, opts := range []Options{
+		{Diameter: 10, DieWidth: 20},
+		{EdgeExclusion: 100},
+		{Bins: map[string]float64{"0#1": 1}},
+		{Bins: map[string]float64{"001": 0}},
+		{SkipRate: 2},
+		{Patterns: []Pattern{{Kind: "donut", Bin: "005"}}},
+		{Patterns: []Pattern{{Kind: PatternEdge, Bin: "005", Density: 1.5}}},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+	if err := (Options{}).Validate(); err != nil {
+		t.Errorf("zero options: %v", err)
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	got, err := ParsePatterns("cluster:005:4, edge:012:1:0.5,scratch:099")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pattern{
+		{Kind: PatternCluster, Bin: "005", Size: 4},
+		{Kind: PatternEdge, Bin: "012", Size: 1, Density: 0.5},
+		{Kind: PatternScratch, Bin: "099"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("patterns = %+v, want %+v", got, want)
+	}
+	for _, s := range []string{"donut:005", "edge", "edge:012:x"} {
+		if _, err := ParsePatterns(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+
+	bins, err := ParseBins("001:92, 005:3")
+	if err != nil || !reflect.DeepEqual(bins, map[string]float64{"001": 92, "005": 3}) {
+		t.Errorf("bins = %v, %v", bins, err)
+	}
+	if _, err := ParseBins("001"); err == nil {
+		t.Error("missing weight: expected error")
+	}
+}
@@ -0,0 +1,60 @@
+package mapping
+
+import (
+	"sort"
+
+	"deviceParser/model"
+)
+
+// BinLimit 单个 bin 的统计限值 (SBL)，为空的字段表示不检查
+// 限值为 0 表示该 bin 不允许出现
+type BinLimit struct {
+	MaxCount   *int     `json:"maxCount,omitempty"`
+	MaxPercent *float64 `json:"maxPercent,omitempty"` // 占该晶圆全部 die 的百分比
+}
+
+// Limits 每片晶圆需要满足的全部限值
+type Limits struct {
+	Bins     map[string]BinLimit
+	MinYield float64
+}
+
+// EvaluateLimits 检查单个文件的计数结果，返回全部超限记录 (按 bin 编号排序，良率在最前)
+func EvaluateLimits(result model.FileResult, limits Limits, goodBins []string) []model.Alarm {
+	var alarms []model.Alarm
+	total := result.TotalDies()
+	if total == 0 {
+		return nil
+	}
+
+	if limits.MinYield > 0 {
+		if y := result.Yield(goodBins); y < limits.MinYield {
+			alarms = append(alarms, model.Alarm{Kind: "良率", Value: y, Limit: limits.MinYield})
+		}
+	}
+
+	codes := make([]string, 0, len(limits.Bins))
+	for code := range limits.Bins {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		limit := limits.Bins[code]
+		count := result.Counts[code]
+		if limit.MaxCount != nil && count > *limit.MaxCount {
+			alarms = append(alarms, model.Alarm{Bin: code, Kind: "数量", Value: float64(count), Limit: float64(*limit.MaxCount)})
+		}
+		if percent := float64(count) * 100 / float64(total); limit.MaxPercent != nil && percent > *limit.MaxPercent {
+			alarms = append(alarms, model.Alarm{Bin: code, Kind: "比例", Value: percent, Limit: *limit.MaxPercent})
+		}
+	}
+	return alarms
+}
+
+// ApplyLimits 对每个文件的结果做 SBL 检查并记录在 Alarms 中，返回超限的晶圆数量
+func ApplyLimits(results []model.FileResult, limits Limits, goodBins []string) int {
+	for i := range results {
+		results[i].Alarms = EvaluateLimits(results[i], limits, goodBins)
+	}
+	return model.CountViolating(results)
+}
@@ -0,0 +1,136 @@
+package mapping
+
+import (
+	"reflect"
+	"testing"
+
+	"deviceParser/model"
+)
+
+func intLimit(v int) *int             { return &v }
+func percentLimit(v float64) *float64 { return &v }
+
+func TestEvaluateLimits(t *testing.T) {
+	// 100 颗 die：001 良品 80 颗，005 15 颗，012 5 颗
+	result := model.FileResult{Lot: "A", Wafer: "01", Counts: map[string]int{"001": 80, "005": 15, "012": 5}}
+
+	tests := []struct {
+		name     string
+		limits   Limits
+		goodBins []string
+		want     []model.Alarm
+	}{
+		{name: "no limits"},
+		{
+			name:   "count above limit",
+			limits: Limits{Bins: map[string]BinLimit{"012": {MaxCount: intLimit(4)}}},
+			want:   []model.Alarm{{Bin: "012", Kind: "数量", Value: 5, Limit: 4}},
+		},
+		{
+			name:   "count equal to limit",
+			limits: Limits{Bins: map[string]BinLimit{"012": {MaxCount: intLimit(5)}}},
+		},
+		{
+			// 限值为 0：该 bin 出现即超限，未出现的 bin 不超限
+			name:   "zero count limit",
+			limits: Limits{Bins: map[string]BinLimit{"012": {MaxCount: intLimit(0)}, "099": {MaxCount: intLimit(0)}}},
+			want:   []model.Alarm{{Bin: "012", Kind: "数量", Value: 5, Limit: 0}},
+		},
+		{
+			name:   "percent above limit",
+			limits: Limits{Bins: map[string]BinLimit{"005": {MaxPercent: percentLimit(14.9)}}},
+			want:   []model.Alarm{{Bin: "005", Kind: "比例", Value: 15, Limit: 14.9}},
+		},
+		{
+			name:   "percent equal to limit",
+			limits: Limits{Bins: map[string]BinLimit{"005": {MaxPercent: percentLimit(15)}}},
+		},
+		{
+			name:   "zero percent limit",
+			limits: Limits{Bins: map[string]BinLimit{"005": {MaxPercent: percentLimit(0)}}},
+			want:   []model.Alarm{{Bin: "005", Kind: "比例", Value: 15, Limit: 0}},
+		},
+		{
+			name:   "yield below limit",
+			limits: Limits{MinYield: 80.5},
+			want:   []model.Alarm{{Kind: "良率", Value: 80, Limit: 80.5}},
+		},
+		{
+			name:   "yield equal to limit",
+			limits: Limits{MinYield: 80},
+		},
+		{
+			// 自定义良品 bin 后良率为 95%
+			name:     "yield with good bins",
+			limits:   Limits{MinYield: 90},
+			goodBins: []string{"001", "005"},
+		},
+		{
+			// 良率在最前，其余按 bin 编号排序，同一 bin 先数量后比例
+			name: "order",
+			limits: Limits{
+				Bins: map[string]BinLimit{
+					"012": {MaxCount: intLimit(1)},
+					"005": {MaxCount: intLimit(10), MaxPercent: percentLimit(10)},
+				},
+				MinYield: 90,
+			},
+			want: []model.Alarm{
+				{Kind: "良率", Value: 80, Limit: 90},
+				{Bin: "005", Kind: "数量", Value: 15, Limit: 10},
+				{Bin: "005", Kind: "比例", Value: 15, Limit: 10},
+				{Bin: "012", Kind: "数量", Value: 5, Limit: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EvaluateLimits(result, tt.limits, tt.goodBins); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("alarms = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// 没有 die 时不做检查
+	if got := EvaluateLimits(model.FileResult{}, Limits{MinYield: 50, Bins: map[string]BinLimit{"005": {MaxCount: intLimit(0)}}}, nil); got != nil {
+		t.Errorf("empty result: %+v", got)
+	}
+}
+
+func TestApplyLimits(t *testing.T) {
+	results := []model.FileResult{
+		{Lot: "A", Wafer: "01", Counts: map[string]int{"001": 10}},
+		{Lot: "A", Wafer: "02", Counts: map[string]int{"001": 9, "005": 1}},
+		{Lot: "A", Wafer: "03", Counts: map[string]int{"001": 5, "005": 5}, Alarms: []model.Alarm{{Kind: "旧记录"}}},
+	}
+	n := ApplyLimits(results, Limits{Bins: map[string]BinLimit{"005": {MaxCount: intLimit(0)}}, MinYield: 60}, nil)
+	if n != 2 {
+		t.Errorf("violating = %d, want 2", n)
+	}
+	if len(results[0].Alarms) != 0 || len(results[1].Alarms) != 1 || len(results[2].Alarms) != 2 {
+		t.Errorf("alarms = %+v / %+v / %+v", results[0].Alarms, results[1].Alarms, results[2].Alarms)
+	}
+}
+
+func TestParseProfileLimits(t *testing.T) {
+	profile, err := ParseProfile([]byte(`{"prefix": "BIN", "binLimits": {"005": {"maxCount": 0}, "012": {"maxPercent": 2.5}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := profile.BinLimits["005"]; l.MaxCount == nil || *l.MaxCount != 0 || l.MaxPercent != nil {
+		t.Errorf("005 limit = %+v, want maxCount 0 and no percent limit", l)
+	}
+	if l := profile.BinLimits["012"]; l.MaxCount != nil || l.MaxPercent == nil || *l.MaxPercent != 2.5 {
+		t.Errorf("012 limit = %+v", l)
+	}
+
+	for _, content := range []string{
+		`{"binLimits": {"005": {"maxCount": -1}}}`,
+		`{"binLimits": {"005": {"maxPercent": 101}}}`,
+		`{"minYield": -1}`,
+	} {
+		if _, err := ParseProfile([]byte(content)); err == nil {
+			t.Errorf("%s: expected error", content)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package mapping 管理映射配置 (bin 名称、良品 bin、SBL 限值、SPC 与 MES 设置) 以及重判规则
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"deviceParser/mes"
+	"deviceParser/model"
+	"deviceParser/parser"
+	"deviceParser/spc"
+)
+
+// DefaultPrefix 未配置名称的 bin 在报表中使用的默认前缀
+const DefaultPrefix = "BIN"
+
+// Profile 映射配置文件，保存 bin 名称映射、默认前缀、良品 bin、SBL 限值、map 文件编码以及 MES 上传设置
+//
+// 示例：
+//
+//	{
+//	  "prefix": "BIN",
+//	  "names": {"001": "PASS", "005": "OPEN"},
+//	  "goodBins": ["001"],
+//	  "binLimits": {"005": {"maxCount": 20, "maxPercent": 1.5}},
+//	  "minYield": 92,
+//	  "product": "XYZ-100",
+//	  "encoding": "gbk",
+//	  "spc": {"method": "mad", "k": 3, "minSamples": 20},
+//	  "mes": {"url": "http://mes.local/api/wafer-bins", "timeoutSeconds": 10, "retries": 3}
+//	}
+type Profile struct {
+	Prefix    string              `json:"prefix"`
+	Names     map[string]string   `json:"names"`
+	GoodBins  []string            `json:"goodBins,omitempty"`
+	BinLimits map[string]BinLimit `json:"binLimits,omitempty"`
+	MinYield  float64             `json:"minYield,omitempty"` // 最低良率 (百分比)，0 表示不检查
+	Product   string              `json:"product,omitempty"`  // 产品名，历史数据按产品分组
+	SPC       *spc.Options        `json:"spc,omitempty"`      // 为空时不做动态限值检查
+	MES       *mes.Options        `json:"mes,omitempty"`      // 为空时不上传到 MES
+	Encoding  string              `json:"encoding,omitempty"` // map 文件编码 (auto/utf-8/gbk/utf-16le/utf-16be)，为空时自动检测
+}
+
+// LoadProfile 读取映射配置文件
+func LoadProfile(filePath string) (Profile, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return Profile{}, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	return ParseProfile(content)
+}
+
+// ParseProfile 解析并校验映射配置内容
+func ParseProfile(content []byte) (Profile, error) {
+	var profile Profile
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return Profile{}, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	for code, limit := range profile.BinLimits {
+		if (limit.MaxCount != nil && *limit.MaxCount < 0) || (limit.MaxPercent != nil && (*limit.MaxPercent < 0 || *limit.MaxPercent > 100)) {
+			return Profile{}, fmt.Errorf("bin %s 的限值无效", code)
+		}
+	}
+	if profile.MinYield < 0 || profile.MinYield > 100 {
+		return Profile{}, fmt.Errorf("最低良率 %.2f 超出 0-100 范围", profile.MinYield)
+	}
+	if err := parser.ValidateEncoding(profile.Encoding); err != nil {
+		return Profile{}, err
+	}
+	if profile.SPC != nil {
+		if err := profile.SPC.Validate(); err != nil {
+			return Profile{}, err
+		}
+	}
+	if profile.MES != nil {
+		if err := profile.MES.Validate(); err != nil {
+			return Profile{}, err
+		}
+	}
+	return profile, nil
+}
+
+// SaveProfile 将映射配置写入文件
+func SaveProfile(filePath string, profile Profile) error {
+	content, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化配置失败: %w", err)
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("保存到磁盘失败: %w", err)
+	}
+	return nil
+}
+
+// BinNames 返回报表使用的 bin 显示名称，未设置前缀时使用 DefaultPrefix
+func (p Profile) BinNames() model.BinNames {
+	prefix := p.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return model.BinNames{Names: p.Names, Prefix: prefix}
+}
+
+// Limits 返回配置中的 SBL 限值
+func (p Profile) Limits() Limits {
+	return Limits{Bins: p.BinLimits, MinYield: p.MinYield}
+}
+
+// ParserOptions 返回按配置中的文件编码解析 map 文件的参数
+func (p Profile) ParserOptions() parser.Options {
+	return parser.Options{Encoding: p.Encoding}
+}
@@ -0,0 +1,123 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"deviceParser/model"
+)
+
+// Rule 一条重判规则：满足条件的晶圆上，From 中的 bin 全部改判为 To
+//
+// 规则文件为 JSON，例如：
+//
+//	{"rules": [
+//	  {"from": ["011", "012", "013"], "to": "010"},
+//	  {"from": ["007"], "to": "099", "lotPrefix": "A1"}
+//	]}
+type Rule struct {
+	From      []string `json:"from"`
+	To        string   `json:"to"`
+	LotPrefix string   `json:"lotPrefix,omitempty"` // 仅对该前缀开头的 LOT 生效，为空表示所有 LOT
+	Wafers    []string `json:"wafers,omitempty"`    // 仅对列出的 WAFER 生效，为空表示所有 WAFER
+}
+
+// ruleFile 规则文件的顶层结构
+type ruleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules 读取并校验重判规则文件
+func LoadRules(filePath string) ([]Rule, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取规则文件失败: %w", err)
+	}
+
+	var rf ruleFile
+	if err := json.Unmarshal(content, &rf); err != nil {
+		return nil, fmt.Errorf("解析规则文件失败: %w", err)
+	}
+	for i, rule := range rf.Rules {
+		if len(rule.From) == 0 || strings.TrimSpace(rule.To) == "" {
+			return nil, fmt.Errorf("第 %d 条规则缺少 from 或 to", i+1)
+		}
+		for _, code := range append(rule.From, rule.To) {
+			if model.IsPlaceholder(code) {
+				return nil, fmt.Errorf("第 %d 条规则不能包含占位符 %s", i+1, code)
+			}
+		}
+	}
+	return rf.Rules, nil
+}
+
+// matches 判断规则是否适用于指定晶圆
+func (r Rule) matches(lot, wafer string) bool {
+	if !strings.HasPrefix(lot, r.LotPrefix) {
+		return false
+	}
+	if len(r.Wafers) == 0 {
+		return true
+	}
+	for _, w := range r.Wafers {
+		if w == wafer {
+			return true
+		}
+	}
+	return false
+}
+
+// rebinTable 将适用于该晶圆的规则展开为 原编号->新编号 的对照表
+// 同一编号命中多条规则时以第一条为准，改判结果不会再次参与改判
+func rebinTable(rules []Rule, lot, wafer string) map[string]string {
+	table := make(map[string]string)
+	for _, rule := range rules {
+		if !rule.matches(lot, wafer) {
+			continue
+		}
+		for _, from := range rule.From {
+			if _, ok := table[from]; !ok {
+				table[from] = rule.To
+			}
+		}
+	}
+	return table
+}
+
+// RebinCounts 对单个文件的计数结果应用重判规则
+func RebinCounts(rules []Rule, result model.FileResult) model.FileResult {
+	table := rebinTable(rules, result.Lot, result.Wafer)
+	if len(table) == 0 {
+		return result
+	}
+
+	counts := make(map[string]int, len(result.Counts))
+	for code, n := range result.Counts {
+		if to, ok := table[code]; ok {
+			code = to
+		}
+		counts[code] += n
+	}
+	result.Counts = counts
+	return result
+}
+
+// RebinWaferMap 对网格中的每个 die 应用重判规则，返回新的 map，原 map 不变
+func RebinWaferMap(rules []Rule, m model.WaferMap) model.WaferMap {
+	table := rebinTable(rules, m.Lot, m.Wafer)
+
+	rows := make([][]string, len(m.Rows))
+	for i, row := range m.Rows {
+		rows[i] = make([]string, len(row))
+		for j, token := range row {
+			if to, ok := table[token]; ok {
+				token = to
+			}
+			rows[i][j] = token
+		}
+	}
+	m.Rows = rows
+	return m
+}
@@ -0,0 +1,118 @@
+package mapping
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"deviceParser/model"
+)
+
+func TestRebinCounts(t *testing.T) {
+	rules := []Rule{
+		{From: []string{"011", "012", "013"}, To: "010"},
+		// 012 已被第一条规则命中，不再改判为 020；改判结果 010 也不会再被第三条规则改判
+		{From: []string{"012", "014"}, To: "020"},
+		{From: []string{"010"}, To: "099"},
+		{From: []string{"005"}, To: "050", LotPrefix: "A1"},
+		{From: []string{"006"}, To: "060", Wafers: []string{"02", "03"}},
+	}
+	counts := map[string]int{"001": 90, "010": 1, "011": 2, "012": 3, "013": 4, "014": 5, "005": 6, "006": 7}
+
+	tests := []struct {
+		name       string
+		lot, wafer string
+		want       map[string]int
+	}{
+		{
+			// 011、012、013 合并到 010，原有的 010 改判为 099
+			name: "all conditions match",
+			lot:  "A100", wafer: "02",
+			want: map[string]int{"001": 90, "099": 1, "010": 9, "020": 5, "050": 6, "060": 7},
+		},
+		{
+			name: "lot prefix does not match",
+			lot:  "B100", wafer: "02",
+			want: map[string]int{"001": 90, "099": 1, "010": 9, "020": 5, "005": 6, "060": 7},
+		},
+		{
+			name: "wafer not listed",
+			lot:  "A100", wafer: "01",
+			want: map[string]int{"001": 90, "099": 1, "010": 9, "020": 5, "050": 6, "006": 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := model.FileResult{Lot: tt.lot, Wafer: tt.wafer, Counts: counts}
+			got := RebinCounts(rules, result)
+			if !reflect.DeepEqual(got.Counts, tt.want) {
+				t.Errorf("counts = %v, want %v", got.Counts, tt.want)
+			}
+			if got.TotalDies() != result.TotalDies() {
+				t.Errorf("total = %d, want %d", got.TotalDies(), result.TotalDies())
+			}
+		})
+	}
+	if counts["011"] != 2 {
+		t.Error("RebinCounts modified its input")
+	}
+
+	// 没有适用的规则时原样返回
+	result := model.FileResult{Lot: "C1", Wafer: "01", Counts: map[string]int{"007": 1}}
+	if got := RebinCounts(rules[3:], result); !reflect.DeepEqual(got, result) {
+		t.Errorf("no matching rule: %+v", got)
+	}
+}
+
+func TestRebinWaferMap(t *testing.T) {
+	rules := []Rule{
+		{From: []string{"011", "012"}, To: "010"},
+		{From: []string{"010"}, To: "099"},
+		{From: []string{"005"}, To: "050", LotPrefix: "Z"},
+	}
+	m := model.WaferMap{Lot: "A1", Wafer: "01", Rows: [][]string{
+		{"___", "011", "001", "___"},
+		{"010", "012", "...", "005"},
+	}}
+	got := RebinWaferMap(rules, m)
+	want := [][]string{
+		{"___", "010", "001", "___"},
+		{"099", "010", "...", "005"},
+	}
+	if !reflect.DeepEqual(got.Rows, want) {
+		t.Errorf("rows = %v, want %v", got.Rows, want)
+	}
+	if m.Rows[0][1] != "011" {
+		t.Error("RebinWaferMap modified its input")
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		ok      bool
+	}{
+		{"valid", `{"rules": [{"from": ["011", "012"], "to": "010"}, {"from": ["007"], "to": "099", "lotPrefix": "A1", "wafers": ["01"]}]}`, true},
+		{"missing to", `{"rules": [{"from": ["011"]}]}`, false},
+		{"missing from", `{"rules": [{"to": "010"}]}`, false},
+		{"placeholder", `{"rules": [{"from": ["..."], "to": "010"}]}`, false},
+		{"malformed", `{"rules": [`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := LoadRules(path)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok=%v", err, tt.ok)
+			}
+			if tt.ok && (len(rules) != 2 || rules[1].LotPrefix != "A1" || !reflect.DeepEqual(rules[1].Wafers, []string{"01"})) {
+				t.Errorf("rules = %+v", rules)
+			}
+		})
+	}
+}
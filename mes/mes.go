@@ -0,0 +1,268 @@
+// Package mes 将每片晶圆的计数结果上传到 MES，失败的记录保存在待发送目录中，下次上传时补发
+package mes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"deviceParser/model"
+)
+
+// ErrRejected MES 以 4xx 拒收记录 (408、429 除外)，重发也不会成功
+var ErrRejected = errors.New("MES 拒收")
+
+// Options MES 上传设置，保存在映射配置中
+type Options struct {
+	URL            string            `json:"url"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"` // 单次请求超时，默认 10 秒
+	Retries        int               `json:"retries,omitempty"`        // 失败后的重试次数，默认 3 次
+	Headers        map[string]string `json:"headers,omitempty"`        // 附加请求头，如认证令牌
+	OutboxDir      string            `json:"outboxDir,omitempty"`      // 待发送目录，默认位于用户配置目录
+
+	RetryDelay time.Duration `json:"-"` // 第一次重试前的等待时间，之后每次翻倍，为 0 时为 1 秒
+}
+
+// Validate 检查参数并填充默认值
+func (o *Options) Validate() error {
+	if !strings.HasPrefix(o.URL, "http://") && !strings.HasPrefix(o.URL, "https://") {
+		return fmt.Errorf("MES 地址 %q 应以 http:// 或 https:// 开头", o.URL)
+	}
+	if o.TimeoutSeconds < 0 || o.Retries < 0 {
+		return errors.New("MES 超时和重试次数不能为负数")
+	}
+	if o.TimeoutSeconds == 0 {
+		o.TimeoutSeconds = 10
+	}
+	if o.Retries == 0 {
+		o.Retries = 3
+	}
+	return nil
+}
+
+// outboxPath 返回待发送目录
+func (o Options) outboxPath() (string, error) {
+	if o.OutboxDir != "" {
+		return o.OutboxDir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("无法定位用户配置目录: %w", err)
+	}
+	return filepath.Join(dir, "deviceParser", "outbox"), nil
+}
+
+// rejectedDirName 待发送目录下保存被拒收记录的子目录，其中的记录不再补发，需人工处理
+const rejectedDirName = "rejected"
+
+// Payload 上传到 MES 的单片晶圆数据
+type Payload struct {
+	Product    string         `json:"product,omitempty"`
+	Lot        string         `json:"lot"`
+	Wafer      string         `json:"wafer"`
+	FileName   string         `json:"fileName"`
+	SourceHash string         `json:"sourceHash"` // 可用于 MES 端去重
+	RunTime    time.Time      `json:"runTime"`
+	Counts     map[string]int `json:"counts"`
+	Total      int            `json:"total"`
+	Yield      float64        `json:"yield"`
+	Alarms     []string       `json:"alarms,omitempty"`
+}
+
+// NewPayload 根据计数结果生成上传数据
+func NewPayload(result model.FileResult, product string, goodBins []string, runTime time.Time) Payload {
+	p := Payload{
+		Product:    product,
+		Lot:        result.Lot,
+		Wafer:      result.Wafer,
+		FileName:   result.FileName,
+		SourceHash: result.SourceHash,
+		RunTime:    runTime,
+		Counts:     result.Counts,
+		Total:      result.TotalDies(),
+		Yield:      result.Yield(goodBins),
+	}
+	for _, a := range result.Alarms {
+		p.Alarms = append(p.Alarms, a.String())
+	}
+	return p
+}
+
+// Report 一次上传的统计
+type Report struct {
+	Sent     int // 本次成功发送的记录 (含补发的)
+	Resent   int // 其中从待发送目录补发的记录
+	Queued   int // 发送失败、保存到待发送目录的记录
+	Rejected int // 被 MES 拒收、移到 rejected 子目录的记录 (含补发的)
+	LastErr  error
+}
+
+// Note 返回附加在完成提示中的说明
+func (r Report) Note() string {
+	note := fmt.Sprintf("\n已上传 %d 条记录到 MES", r.Sent)
+	if r.Queued > 0 {
+		note += fmt.Sprintf("，%d 条上传失败已保存到待发送目录", r.Queued)
+	}
+	if r.Rejected > 0 {
+		note += fmt.Sprintf("，%d 条被拒收已移到待发送目录的 %s 子目录", r.Rejected, rejectedDirName)
+	}
+	if r.LastErr != nil {
+		note += fmt.Sprintf(" (%v)", r.LastErr)
+	}
+	return note
+}
+
+// postPayload 发送一条数据，网络错误、5xx、408 及 429 响应会按退避时间重试；
+// 其余 4xx 响应返回包装了 ErrRejected 的错误
+func postPayload(client *http.Client, opts Options, body []byte) error {
+	delay := opts.RetryDelay
+	if delay == 0 {
+		delay = time.Second
+	}
+	var lastErr error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		req, err := http.NewRequest(http.MethodPost, opts.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("创建请求失败: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range opts.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("MES 返回 %s", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %w", ErrRejected, lastErr) // 请求本身有误，重试没有意义
+		}
+	}
+	return lastErr
+}
+
+// outboxFileName 待发送文件名，同一晶圆同一源文件只保留一份
+func outboxFileName(p Payload) string {
+	hash := p.SourceHash
+	if len(hash) > 16 {
+		hash = hash[:16]
+	}
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(p.Lot + "_" + p.Wafer)
+	return fmt.Sprintf("%s_%s.json", name, hash)
+}
+
+// Push 先补发待发送目录中的记录，再逐片上传本次结果；发送失败的记录保存到待发送目录，
+// 被拒收的记录保存到 rejected 子目录，不影响其余记录的发送
+// 只有待发送目录无法读写时才返回错误
+func Push(results []model.FileResult, product string, opts Options, goodBins []string) (Report, error) {
+	var report Report
+	outbox, err := opts.outboxPath()
+	if err != nil {
+		return report, err
+	}
+	if err := os.MkdirAll(outbox, 0755); err != nil {
+		return report, fmt.Errorf("创建待发送目录失败: %w", err)
+	}
+	rejectedDir := filepath.Join(outbox, rejectedDirName)
+	client := &http.Client{Timeout: time.Duration(opts.TimeoutSeconds) * time.Second}
+
+	entries, err := os.ReadDir(outbox)
+	if err != nil {
+		return report, fmt.Errorf("读取待发送目录失败: %w", err)
+	}
+	var pending []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			pending = append(pending, entry.Name())
+		}
+	}
+	sort.Strings(pending)
+
+	// unavailable 非空表示 MES 暂时不可用，之后的记录直接保存，避免每条记录都等待全部重试
+	var unavailable error
+	for i, name := range pending {
+		filePath := filepath.Join(outbox, name)
+		body, err := os.ReadFile(filePath)
+		if err != nil {
+			return report, fmt.Errorf("读取待发送记录失败: %w", err)
+		}
+		err = postPayload(client, opts, body)
+		switch {
+		case err == nil:
+			if err := os.Remove(filePath); err != nil {
+				return report, fmt.Errorf("删除已发送记录失败: %w", err)
+			}
+			report.Sent++
+			report.Resent++
+		case errors.Is(err, ErrRejected):
+			report.Rejected++
+			report.LastErr = fmt.Errorf("%s: %w", name, err)
+			if err := os.MkdirAll(rejectedDir, 0755); err != nil {
+				return report, fmt.Errorf("创建拒收记录目录失败: %w", err)
+			}
+			if err := os.Rename(filePath, filepath.Join(rejectedDir, name)); err != nil {
+				return report, fmt.Errorf("移动拒收记录失败: %w", err)
+			}
+		default:
+			// 其余记录留到下次再补发
+			report.Queued += len(pending) - i
+			report.LastErr = err
+			unavailable = err
+		}
+		if unavailable != nil {
+			break
+		}
+	}
+
+	runTime := time.Now()
+	for _, result := range results {
+		payload := NewPayload(result, product, goodBins, runTime)
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return report, fmt.Errorf("序列化上传数据失败: %w", err)
+		}
+		dir := outbox
+		if unavailable == nil {
+			err := postPayload(client, opts, body)
+			if err == nil {
+				report.Sent++
+				continue
+			}
+			report.LastErr = err
+			if errors.Is(err, ErrRejected) {
+				report.Rejected++
+				dir = rejectedDir
+				if err := os.MkdirAll(rejectedDir, 0755); err != nil {
+					return report, fmt.Errorf("创建拒收记录目录失败: %w", err)
+				}
+			} else {
+				unavailable = err
+			}
+		}
+		if dir == outbox {
+			report.Queued++
+		}
+		if err := os.WriteFile(filepath.Join(dir, outboxFileName(payload)), body, 0644); err != nil {
+			return report, fmt.Errorf("保存待发送记录失败: %w", err)
+		}
+	}
+	return report, nil
+}
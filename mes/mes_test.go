@@ -0,0 +1,164 @@
+package mes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"deviceParser/model"
+)
+
+// mesStub 本地替身服务器，前 failures 次请求返回 503
+type mesStub struct {
+	mu       sync.Mutex
+	failures int
+	received []Payload
+}
+
+func (s *mesStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	var p Payload
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.received = append(s.received, p)
+}
+
+func testMESResults() []model.FileResult {
+	return []model.FileResult{
+		{FileName: "a.txt", Lot: "L1", Wafer: "01", SourceHash: "aaaa", Counts: map[string]int{"001": 3, "005": 1}},
+		{FileName: "b.txt", Lot: "L1", Wafer: "02", SourceHash: "bbbb", Counts: map[string]int{"001": 4}},
+	}
+}
+
+func outboxCount(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestPushResultsRetries(t *testing.T) {
+	stub := &mesStub{failures: 2}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	opts := Options{URL: server.URL, Retries: 3, OutboxDir: t.TempDir(), RetryDelay: time.Millisecond}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Push(testMESResults(), "XYZ", opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 2 || report.Queued != 0 {
+		t.Fatalf("report = %+v, want 2 sent", report)
+	}
+	if len(stub.received) != 2 || stub.received[0].Yield != 75 || stub.received[0].Total != 4 || stub.received[0].Product != "XYZ" {
+		t.Fatalf("received = %+v", stub.received)
+	}
+	if n := outboxCount(t, opts.OutboxDir); n != 0 {
+		t.Fatalf("outbox has %d entries, want 0", n)
+	}
+}
+
+func TestPushResultsOutbox(t *testing.T) {
+	stub := &mesStub{failures: 1 << 30}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	opts := Options{URL: server.URL, Retries: 1, OutboxDir: t.TempDir(), RetryDelay: time.Millisecond}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Push(testMESResults(), "", opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 0 || report.Queued != 2 || report.LastErr == nil {
+		t.Fatalf("report = %+v, want 2 queued", report)
+	}
+	if n := outboxCount(t, opts.OutboxDir); n != 2 {
+		t.Fatalf("outbox has %d entries, want 2", n)
+	}
+
+	// 服务恢复后，下一次运行先补发待发送记录
+	stub.failures = 0
+	report, err = Push(nil, "", opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 2 || report.Resent != 2 || report.Queued != 0 {
+		t.Fatalf("report = %+v, want 2 resent", report)
+	}
+	if n := outboxCount(t, opts.OutboxDir); n != 0 {
+		t.Fatalf("outbox has %d entries, want 0", n)
+	}
+	if len(stub.received) != 2 || stub.received[0].Lot != "L1" || stub.received[0].Wafer != "01" {
+		t.Fatalf("received = %+v", stub.received)
+	}
+}
+
+func TestPushRejected(t *testing.T) {
+	// 批号 L0 的记录被拒收，其余正常接收
+	var mu sync.Mutex
+	var received []Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Lot == "L0" {
+			http.Error(w, "invalid lot", http.StatusUnprocessableEntity)
+			return
+		}
+		received = append(received, p)
+	}))
+	defer server.Close()
+
+	opts := Options{URL: server.URL, Retries: 3, OutboxDir: t.TempDir(), RetryDelay: time.Millisecond}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// 待发送目录按文件名排序补发，被拒收的记录在前
+	for name, body := range map[string]string{
+		"L0_01_0000.json": `{"lot":"L0","wafer":"01"}`,
+		"L1_00_1111.json": `{"lot":"L1","wafer":"00"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(opts.OutboxDir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := append(testMESResults(), model.FileResult{FileName: "c.txt", Lot: "L0", Wafer: "03", SourceHash: "cccc"})
+	report, err := Push(results, "", opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 3 || report.Resent != 1 || report.Rejected != 2 || report.Queued != 0 || !errors.Is(report.LastErr, ErrRejected) {
+		t.Fatalf("report = %+v, want 3 sent, 1 resent, 2 rejected", report)
+	}
+	if len(received) != 3 || received[0].Wafer != "00" || received[1].Wafer != "01" || received[2].Wafer != "02" {
+		t.Fatalf("received = %+v", received)
+	}
+	if n := outboxCount(t, opts.OutboxDir); n != 1 {
+		t.Fatalf("outbox has %d entries, want only the rejected directory", n)
+	}
+	if n := outboxCount(t, filepath.Join(opts.OutboxDir, rejectedDirName)); n != 2 {
+		t.Fatalf("rejected directory has %d entries, want 2", n)
+	}
+}
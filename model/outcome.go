@@ -0,0 +1,108 @@
+package model
+
+import "fmt"
+
+// Severity 校验问题的严重程度
+type Severity string
+
+const (
+	SeverityError   Severity = "错误" // 严格模式下拒绝该文件
+	SeverityWarning Severity = "警告"
+)
+
+// Diagnostic 一条校验问题，Line、Column 从 1 开始，为 0 表示不针对具体行或列
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int // RowData 中的 die 序号
+	Severity Severity
+	Message  string
+}
+
+// String 返回 "文件:行:列: 严重程度: 说明" 形式的描述，便于在命令行中定位
+func (d Diagnostic) String() string {
+	pos := d.File
+	if d.Line > 0 {
+		pos += fmt.Sprintf(":%d", d.Line)
+		if d.Column > 0 {
+			pos += fmt.Sprintf(":%d", d.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, d.Severity, d.Message)
+}
+
+// HasErrors 判断是否存在错误级别的问题
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// FileStatus 单个文件的处理结果
+type FileStatus string
+
+const (
+	StatusOK              FileStatus = "成功"
+	StatusNoData          FileStatus = "无数据"
+	StatusMissingLotWafer FileStatus = "缺少 LOT/WAFER"
+	StatusReadError       FileStatus = "读取失败"
+	StatusMalformedRow    FileStatus = "RowData 格式错误"
+	StatusInvalid         FileStatus = "校验失败" // 严格模式下存在错误级别的校验问题
+)
+
+// FileOutcome 批处理中单个文件的处理记录，显示在界面结果表及汇总表的 Log 工作表中
+type FileOutcome struct {
+	Path   string
+	Name   string
+	Status FileStatus
+	Lot    string
+	Wafer  string
+	Detail string
+
+	Diagnostics []Diagnostic // 校验发现的问题，非严格模式下仅作提示
+}
+
+// OK 判断文件是否成功提取
+func (o FileOutcome) OK() bool {
+	return o.Status == StatusOK
+}
+
+// Failed 判断文件是否处理失败 (无数据的文件不算失败)
+func (o FileOutcome) Failed() bool {
+	return !o.OK() && o.Status != StatusNoData
+}
+
+// Fail 将已提取成功的文件在后续步骤 (如读取完整网格) 中的错误记为读取失败
+func (o *FileOutcome) Fail(err error) {
+	o.Status = StatusReadError
+	o.Detail = err.Error()
+}
+
+// CountFailed 返回处理失败的文件数量 (无数据的文件不计入)
+func CountFailed(outcomes []FileOutcome) int {
+	failed := 0
+	for _, o := range outcomes {
+		if o.Failed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// OutcomeSummary 返回附加在完成提示中的说明
+func OutcomeSummary(outcomes []FileOutcome) string {
+	counts := make(map[FileStatus]int)
+	for _, o := range outcomes {
+		counts[o.Status]++
+	}
+	text := fmt.Sprintf("共 %d 个文件，成功 %d 个", len(outcomes), counts[StatusOK])
+	for _, status := range []FileStatus{StatusNoData, StatusMissingLotWafer, StatusMalformedRow, StatusInvalid, StatusReadError} {
+		if counts[status] > 0 {
+			text += fmt.Sprintf("，%s %d 个", status, counts[status])
+		}
+	}
+	return text
+}
@@ -0,0 +1,144 @@
+// Package model 定义解析、分析与报表之间共用的数据结构：单片晶圆的计数结果、完整网格、超限记录及文件处理记录
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNoData 文件或结果集中没有任何 bin 数据
+var ErrNoData = errors.New("no data found")
+
+// FileResult holds the parsed data from a single wafer (one LOT/WAFER block of an input file).
+type FileResult struct {
+	FileName   string
+	SourcePath string // 源文件完整路径，从数据库读取的结果为空
+	Lot        string
+	Wafer      string
+	Block      int // 多晶圆文件中的块序号 (从 1 开始)，单晶圆文件为 0
+	Duplicate  int // 同一批次中 LOT、WAFER 重复且全部保留时的序号 (第二个起为 2、3…)，只用于报表中区分，其余为 0
+	Counts     map[string]int
+
+	Metadata   map[string]string // 除 LOT/WAFER 外的其余头部信息，如 DEVICE、TEST DATE
+	SourceHash string            // 源文件内容的 SHA-256，用于识别重复导入
+
+	Clusters *ClusterSummary // 失效簇分析结果，未启用分析时为 nil
+	Alarms   []Alarm         // SBL 超限记录
+}
+
+// TotalDies 返回计数结果中的 die 总数
+func (r FileResult) TotalDies() int {
+	total := 0
+	for _, n := range r.Counts {
+		total += n
+	}
+	return total
+}
+
+// Yield 返回良率百分比，没有 die 时返回 0
+func (r FileResult) Yield(goodBins []string) float64 {
+	total := r.TotalDies()
+	if total == 0 {
+		return 0
+	}
+	good := 0
+	for code, n := range r.Counts {
+		if IsGoodBin(code, goodBins) {
+			good += n
+		}
+	}
+	return float64(good) * 100 / float64(total)
+}
+
+// BinPercents 计算各 bin 占该晶圆全部 die 的百分比
+func (r FileResult) BinPercents() map[string]float64 {
+	percents := make(map[string]float64, len(r.Counts))
+	total := r.TotalDies()
+	if total == 0 {
+		return percents
+	}
+	for code, n := range r.Counts {
+		percents[code] = float64(n) * 100 / float64(total)
+	}
+	return percents
+}
+
+// IsGoodBin 判断 bin 编号是否为良品，goodBins 为空时将数值为 1 的编号视为良品
+func IsGoodBin(code string, goodBins []string) bool {
+	if len(goodBins) == 0 {
+		n, err := strconv.Atoi(code)
+		return err == nil && n == 1
+	}
+	for _, g := range goodBins {
+		if g == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Alarm 一条超限记录，Bin 为空表示良率超限
+type Alarm struct {
+	Bin   string
+	Kind  string // 数量 / 比例 / 良率 / SPC上限 / SPC下限
+	Value float64
+	Limit float64
+}
+
+// String 返回便于在界面和命令行中展示的描述
+func (a Alarm) String() string {
+	switch a.Kind {
+	case "良率":
+		return fmt.Sprintf("良率 %.2f%% 低于下限 %.2f%%", a.Value, a.Limit)
+	case "比例":
+		return fmt.Sprintf("bin %s 占比 %.2f%% 超过上限 %.2f%%", a.Bin, a.Value, a.Limit)
+	case "SPC上限":
+		return fmt.Sprintf("bin %s 占比 %.2f%% 超过历史上限 %.2f%%", a.Bin, a.Value, a.Limit)
+	case "SPC下限":
+		return fmt.Sprintf("bin %s 占比 %.2f%% 低于历史下限 %.2f%%", a.Bin, a.Value, a.Limit)
+	}
+	return fmt.Sprintf("bin %s 数量 %.0f 超过上限 %.0f", a.Bin, a.Value, a.Limit)
+}
+
+// CountViolating 返回存在超限记录的晶圆数量
+func CountViolating(results []FileResult) int {
+	violating := 0
+	for _, result := range results {
+		if len(result.Alarms) > 0 {
+			violating++
+		}
+	}
+	return violating
+}
+
+// ClusterBox 单个失效簇的大小及外接矩形 (行列从 0 开始，含边界)
+type ClusterBox struct {
+	Size   int
+	MinRow int
+	MinCol int
+	MaxRow int
+	MaxCol int
+}
+
+// ClusterSummary 单个晶圆的失效簇统计
+type ClusterSummary struct {
+	Count   int
+	Largest int
+	Boxes   []ClusterBox // 按簇大小降序排列
+	Flagged bool         // 是否超过阈值
+}
+
+// BinNames 报表中 bin 编号的显示名称，未配置名称的编号显示为 Prefix + 编号
+type BinNames struct {
+	Names  map[string]string
+	Prefix string
+}
+
+// Name 返回编号的显示名称
+func (n BinNames) Name(code string) string {
+	if name, ok := n.Names[code]; ok {
+		return name
+	}
+	return n.Prefix + code
+}
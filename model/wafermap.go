@@ -0,0 +1,71 @@
+package model
+
+const (
+	EmptyDie   = "___" // 该位置没有 die (晶圆外)
+	SkippedDie = "..." // 该位置有 die 但未给出测试结果
+)
+
+// IsPlaceholder 判断 token 是否为占位符而非真正的 bin 编号
+func IsPlaceholder(token string) bool {
+	return token == EmptyDie || token == SkippedDie
+}
+
+// TextEncoding 文件实际使用的编码，写回文件时按原编码输出
+type TextEncoding struct {
+	Name string
+	BOM  bool
+}
+
+// WaferMap 保存单个晶圆完整的 RowData 网格，供合并等需要 die 坐标的操作使用
+type WaferMap struct {
+	FileName string
+	Lot      string
+	Wafer    string
+	Block    int        // 多晶圆文件中的块序号 (从 1 开始)，单晶圆文件为 0
+	Rows     [][]string // 每行一个切片，元素为 bin 编号或占位符
+
+	// 以下字段用于按原样写回文件，在内存中新建的 map 可以留空
+	Header     []string     // 第一行 RowData 之前的原始行 (含 LOT/WAFER 行)
+	Trailer    []string     // 第一行 RowData 之后的非 RowData 行，写回时放在所有 RowData 之后
+	Lines      []string     // 原文件中该块的原始行 (各自带原换行符)，写回时未修改的行按原样输出；为空时按以上字段生成
+	LineEnding string       // 原文件的换行符，为空时使用 "\n"
+	Encoding   TextEncoding // 原文件的编码，为空时按不带 BOM 的 UTF-8 写出
+}
+
+// Pos 网格中 die 的位置，Row/Col 均从 0 开始
+type Pos struct {
+	Row int
+	Col int
+}
+
+// At 返回指定位置的 token，越界时返回 ok=false
+func (m WaferMap) At(p Pos) (string, bool) {
+	if p.Row < 0 || p.Row >= len(m.Rows) || p.Col < 0 || p.Col >= len(m.Rows[p.Row]) {
+		return "", false
+	}
+	return m.Rows[p.Row][p.Col], true
+}
+
+// Counts 统计每个 bin 编号出现的次数，占位符不计入
+func (m WaferMap) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, row := range m.Rows {
+		for _, token := range row {
+			if !IsPlaceholder(token) {
+				counts[token]++
+			}
+		}
+	}
+	return counts
+}
+
+// ToFileResult 将网格转换为报表使用的计数结果
+func (m WaferMap) ToFileResult() FileResult {
+	return FileResult{
+		FileName: m.FileName,
+		Lot:      m.Lot,
+		Wafer:    m.Wafer,
+		Block:    m.Block,
+		Counts:   m.Counts(),
+	}
+}
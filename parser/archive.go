@@ -0,0 +1,337 @@
+package parser
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"deviceParser/model"
+)
+
+// 压缩包中的 map 文件以 "压缩包路径/包内路径" 表示，例如 D:\maps\LOT1.zip/sub/01.txt，
+// 包内路径统一使用 "/"；gzip 压缩包只包含一个文件，包内路径为压缩前的文件名
+
+// IsMapFile 判断是否为需要处理的 map 文件
+func IsMapFile(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".txt")
+}
+
+// IsArchive 判断是否为支持的压缩包
+func IsArchive(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	return ext == ".zip" || ext == ".gz"
+}
+
+// splitArchivePath 将压缩包内文件的路径拆分为压缩包路径与包内路径，普通文件返回 ok 为 false
+func splitArchivePath(p string) (archive, entry string, ok bool) {
+	for i := 0; i < len(p); i++ {
+		if p[i] != '/' && p[i] != os.PathSeparator {
+			continue
+		}
+		if !IsArchive(p[:i]) {
+			continue
+		}
+		if fileInfo, err := os.Stat(p[:i]); err == nil && fileInfo.Mode().IsRegular() {
+			return p[:i], p[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// SourceName 返回报表中显示的文件名：普通文件为文件名，压缩包内的文件为 "压缩包名/包内路径"
+func SourceName(p string) string {
+	if archive, entry, ok := splitArchivePath(p); ok {
+		return filepath.Base(archive) + "/" + entry
+	}
+	return filepath.Base(p)
+}
+
+// gzipEntryName 返回 gzip 压缩包中文件的名称，头部未记录时使用去掉 .gz 的压缩包名
+func gzipEntryName(archive string, header gzip.Header) string {
+	if header.Name != "" {
+		return path.Base(filepath.ToSlash(header.Name))
+	}
+	return strings.TrimSuffix(filepath.Base(archive), filepath.Ext(archive))
+}
+
+// openGzip 打开 gzip 压缩包并读取其头部
+func openGzip(archive string) (*os.File, *gzip.Reader, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("解压 %s 失败: %w", filepath.Base(archive), err)
+	}
+	return f, zr, nil
+}
+
+// listArchive 列出压缩包中的全部 .txt 文件 (含子文件夹)，返回可直接传给 Open 的路径
+func listArchive(archive string, archives *Archives) ([]string, error) {
+	if strings.EqualFold(filepath.Ext(archive), ".gz") {
+		f, zr, err := openGzip(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		name := gzipEntryName(archive, zr.Header)
+		if !IsMapFile(name) {
+			return nil, fmt.Errorf("gzip 压缩包中的文件 %s 不是 .txt 文件", name)
+		}
+		return []string{archive + "/" + name}, nil
+	}
+
+	z, err := archives.zip(archive)
+	if err != nil {
+		return nil, err
+	}
+	if archives == nil {
+		defer z.Close()
+	}
+	var files []string
+	for _, f := range z.File {
+		if !f.FileInfo().IsDir() && IsMapFile(f.Name) {
+			files = append(files, archive+"/"+f.Name)
+		}
+	}
+	return files, nil
+}
+
+// zipArchive 已打开的 zip 压缩包及按包内路径建立的索引
+type zipArchive struct {
+	*zip.ReadCloser
+	name    string
+	entries map[string]*zip.File
+	size    int64
+	modTime time.Time
+}
+
+// Archives 一个批次中共用的已打开压缩包：每个 zip 只打开并读取一次目录，包内文件按名称直接定位
+// 零值不可用，使用 NewArchives 创建；批次结束后调用 Close。为 nil 时每次读取都重新打开压缩包
+type Archives struct {
+	mu   sync.Mutex
+	zips map[string]*zipArchive
+}
+
+// NewArchives 创建空的压缩包集合
+func NewArchives() *Archives {
+	return &Archives{zips: make(map[string]*zipArchive)}
+}
+
+// Close 关闭集合中全部已打开的压缩包
+func (a *Archives) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []error
+	for name, z := range a.zips {
+		errs = append(errs, z.Close())
+		delete(a.zips, name)
+	}
+	return errors.Join(errs...)
+}
+
+// zip 返回打开的 zip 压缩包；a 为 nil 时由调用方负责关闭，否则由 Close 统一关闭
+// 压缩包在批次中被修改 (大小或修改时间变化) 时重新打开
+func (a *Archives) zip(archive string) (*zipArchive, error) {
+	fileInfo, err := os.Stat(archive)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if z, ok := a.zips[archive]; ok {
+			if z.size == fileInfo.Size() && z.modTime.Equal(fileInfo.ModTime()) {
+				return z, nil
+			}
+			z.Close()
+			delete(a.zips, archive)
+		}
+	}
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("解压 %s 失败: %w", filepath.Base(archive), err)
+	}
+	z := &zipArchive{ReadCloser: zr, name: archive, entries: make(map[string]*zip.File, len(zr.File)), size: fileInfo.Size(), modTime: fileInfo.ModTime()}
+	for _, f := range zr.File {
+		if _, ok := z.entries[f.Name]; !ok {
+			z.entries[f.Name] = f
+		}
+	}
+	if a != nil {
+		a.zips[archive] = z
+	}
+	return z, nil
+}
+
+// readCloser 关闭时同时关闭压缩包本身
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r readCloser) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Open 打开普通文件或压缩包中的文件，压缩包内的文件在内存中流式解压，不写入磁盘
+func Open(p string) (io.ReadCloser, error) {
+	return (*Archives)(nil).Open(p)
+}
+
+// Open 与包级 Open 相同，压缩包从集合中取得，不再重复打开
+func (a *Archives) Open(p string) (io.ReadCloser, error) {
+	archive, entry, ok := splitArchivePath(p)
+	if !ok {
+		return os.Open(p)
+	}
+
+	if strings.EqualFold(filepath.Ext(archive), ".gz") {
+		f, zr, err := openGzip(archive)
+		if err != nil {
+			return nil, err
+		}
+		if gzipEntryName(archive, zr.Header) != entry {
+			f.Close()
+			return nil, fmt.Errorf("压缩包 %s 中没有 %s", filepath.Base(archive), entry)
+		}
+		return readCloser{Reader: zr, closers: []io.Closer{zr, f}}, nil
+	}
+
+	z, err := a.zip(archive)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := z.open(entry)
+	if a != nil {
+		return rc, err
+	}
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+	return readCloser{Reader: rc, closers: []io.Closer{rc, z}}, nil
+}
+
+// open 打开压缩包中的文件
+func (z *zipArchive) open(entry string) (io.ReadCloser, error) {
+	f, ok := z.entries[entry]
+	if !ok {
+		return nil, fmt.Errorf("压缩包 %s 中没有 %s", filepath.Base(z.name), entry)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("解压 %s 失败: %w", entry, err)
+	}
+	return rc, nil
+}
+
+// readSource 读取普通文件或压缩包中文件的全部内容
+func readSource(p string, archives *Archives) ([]byte, error) {
+	rc, err := archives.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// SourceModTime 返回文件的修改时间，压缩包内的文件使用包内记录的时间
+func SourceModTime(p string) (time.Time, error) {
+	archive, entry, ok := splitArchivePath(p)
+	if !ok {
+		fileInfo, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return fileInfo.ModTime(), nil
+	}
+
+	if strings.EqualFold(filepath.Ext(archive), ".zip") {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.Name == entry {
+				return f.Modified, nil
+			}
+		}
+	} else if f, zr, err := openGzip(archive); err == nil {
+		f.Close()
+		if !zr.ModTime.IsZero() {
+			return zr.ModTime, nil
+		}
+	}
+	fileInfo, err := os.Stat(archive)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fileInfo.ModTime(), nil
+}
+
+// CollectFiles 展开输入路径：文件夹下的 .txt 文件及压缩包全部加入 (不递归)，
+// 压缩包展开为其中的全部 .txt 文件 (含包内子文件夹)，打开的 zip 保留在 archives 中供后续读取
+// 无法打开的压缩包记为读取失败的处理记录，不影响其余输入；只有输入路径或文件夹无法访问时返回错误
+func CollectFiles(paths []string, archives *Archives) ([]string, []model.FileOutcome, error) {
+	var files []string
+	var failed []model.FileOutcome
+	addArchive := func(p string) {
+		entries, err := listArchive(p, archives)
+		if err != nil {
+			failed = append(failed, NewOutcome(p, nil, err))
+			return
+		}
+		files = append(files, entries...)
+	}
+	for _, p := range paths {
+		fileInfo, err := os.Stat(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无法访问路径: %w", err)
+		}
+		if !fileInfo.IsDir() {
+			if IsArchive(p) {
+				addArchive(p)
+			} else {
+				files = append(files, p)
+			}
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取文件夹失败: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			entryPath := filepath.Join(p, entry.Name())
+			if IsArchive(entry.Name()) {
+				addArchive(entryPath)
+			} else if IsMapFile(entry.Name()) {
+				files = append(files, entryPath)
+			}
+		}
+	}
+	return files, failed, nil
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"deviceParser/model"
+)
+
+func TestCollectInputFilesArchives(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)
+
+	zf, err := os.Create(filepath.Join(dir, "LOT1.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	// 按固定顺序写入条目，结果顺序即包内顺序
+	for _, entry := range []struct{ name, content string }{
+		{"01.txt", "LOT: LOT1\nWAFER: 01\nRowData: 001 001\n"},
+		{"sub/02.txt", "LOT: LOT1\nWAFER: 02\nRowData: 001 005\n"},
+		{"sub/notes.csv", "ignored"},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zf.Close()
+
+	gf, err := os.Create(filepath.Join(dir, "LOT2_03.txt.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(gf)
+	gw.Write([]byte("LOT: LOT2\nWAFER: 03\nRowData: 005 001\n"))
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gf.Close()
+
+	// 损坏的压缩包及内容不是 .txt 的 gzip 记为读取失败，其余输入照常展开
+	if err := os.WriteFile(filepath.Join(dir, "broken.zip"), []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cf, err := os.Create(filepath.Join(dir, "notes.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := gzip.NewWriter(cf)
+	cw.Name = "notes.csv"
+	cw.Write([]byte("ignored"))
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cf.Close()
+
+	archives := NewArchives()
+	defer archives.Close()
+	files, failed, err := CollectFiles([]string{dir}, archives)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || failed[0].Name != "broken.zip" || failed[0].Status != model.StatusReadError ||
+		failed[1].Name != "notes.gz" || failed[1].Status != model.StatusReadError || !strings.Contains(failed[1].Detail, "notes.csv 不是 .txt 文件") {
+		t.Errorf("failed = %+v, want broken.zip and notes.gz", failed)
+	}
+	var names []string
+	for _, fPath := range files {
+		results, err := ParseFile(fPath, Options{Archives: archives})
+		if err != nil {
+			t.Fatalf("%s: %v", fPath, err)
+		}
+		for _, result := range results {
+			names = append(names, result.FileName+"="+result.Lot+"-"+result.Wafer)
+		}
+	}
+	want := []string{"LOT1.zip/01.txt=LOT1-01", "LOT1.zip/sub/02.txt=LOT1-02", "LOT2_03.txt.gz/LOT2_03.txt=LOT2-03"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("results = %q, want %q", names, want)
+	}
+
+	// 同一批次中 zip 只打开一次
+	if len(archives.zips) != 1 {
+		t.Errorf("archives has %d open zips, want 1", len(archives.zips))
+	}
+
+	m, err := ReadWaferMap(files[1], Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FileName != "LOT1.zip/sub/02.txt" {
+		t.Errorf("map name = %q", m.FileName)
+	}
+	if got, err := SourceModTime(files[0]); err != nil || !got.Equal(modTime) {
+		t.Errorf("mod time = %v, %v", got, err)
+	}
+	if _, err := ParseFile(filepath.Join(dir, "LOT1.zip", "missing.txt"), Options{}); err == nil {
+		t.Error("missing archive entry did not fail")
+	}
+}
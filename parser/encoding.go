@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+
+	"deviceParser/model"
+)
+
+// 支持的文件编码名称，auto 表示根据 BOM 及内容自动检测
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingGBK     = "gbk" // 按 GB18030 解码，兼容 GBK 与 GB2312
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// sniffBytes 自动检测时查看的文件开头字节数
+const sniffBytes = 4096
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// ValidateEncoding 检查配置中的编码名称，空字符串等同于 auto
+func ValidateEncoding(name string) error {
+	switch name {
+	case "", EncodingAuto, EncodingUTF8, EncodingGBK, EncodingUTF16LE, EncodingUTF16BE:
+		return nil
+	}
+	return fmt.Errorf("不支持的文件编码: %s (可选 auto/utf-8/gbk/utf-16le/utf-16be)", name)
+}
+
+// bomOf 返回该编码的 BOM
+func bomOf(e model.TextEncoding) []byte {
+	switch e.Name {
+	case EncodingUTF16LE:
+		return utf16LEBOM
+	case EncodingUTF16BE:
+		return utf16BEBOM
+	}
+	return utf8BOM
+}
+
+// codecOf 返回对应的转换器，UTF-8 不需要转换时返回 nil
+func codecOf(e model.TextEncoding) encoding.Encoding {
+	switch e.Name {
+	case EncodingGBK:
+		return simplifiedchinese.GB18030
+	case EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case EncodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return nil
+}
+
+// looksUTF16 没有 BOM 时，ASCII 为主的 UTF-16 文本每隔一个字节为 0
+func looksUTF16(sample []byte, littleEndian bool) bool {
+	if len(sample) < 4 {
+		return false
+	}
+	zeros, pairs := 0, len(sample)/2
+	for i := 0; i+1 < len(sample); i += 2 {
+		hi := sample[i]
+		if littleEndian {
+			hi = sample[i+1]
+		}
+		if hi == 0 {
+			zeros++
+		}
+	}
+	return zeros*10 >= pairs*8
+}
+
+// validUTF8Prefix 判断 sample 是否为合法 UTF-8，末尾被截断的多字节字符不算错误
+func validUTF8Prefix(sample []byte) bool {
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(sample)
+}
+
+// detectEncoding 根据文件开头的内容确定编码：name 为 auto 时依次按 BOM、UTF-16 特征、UTF-8 合法性判断，
+// 都不符合时视为 GBK；指定了编码时只检测是否带 BOM
+func detectEncoding(sample []byte, name string) model.TextEncoding {
+	if name != "" && name != EncodingAuto {
+		e := model.TextEncoding{Name: name}
+		e.BOM = name != EncodingGBK && bytes.HasPrefix(sample, bomOf(e))
+		return e
+	}
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		return model.TextEncoding{Name: EncodingUTF8, BOM: true}
+	case bytes.HasPrefix(sample, utf16LEBOM):
+		return model.TextEncoding{Name: EncodingUTF16LE, BOM: true}
+	case bytes.HasPrefix(sample, utf16BEBOM):
+		return model.TextEncoding{Name: EncodingUTF16BE, BOM: true}
+	case looksUTF16(sample, true):
+		return model.TextEncoding{Name: EncodingUTF16LE}
+	case looksUTF16(sample, false):
+		return model.TextEncoding{Name: EncodingUTF16BE}
+	case validUTF8Prefix(sample):
+		return model.TextEncoding{Name: EncodingUTF8}
+	}
+	return model.TextEncoding{Name: EncodingGBK}
+}
+
+// newDecodingReader 返回去掉 BOM 并转换为 UTF-8 的 reader，以流式方式转换，不会整体载入内存
+func newDecodingReader(r io.Reader, name string) (io.Reader, model.TextEncoding, error) {
+	br := bufio.NewReaderSize(r, sniffBytes)
+	sample, err := br.Peek(sniffBytes)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, model.TextEncoding{}, err
+	}
+	enc := detectEncoding(sample, name)
+	if enc.BOM {
+		br.Discard(len(bomOf(enc)))
+	}
+	if e := codecOf(enc); e != nil {
+		return transform.NewReader(br, e.NewDecoder()), enc, nil
+	}
+	return br, enc, nil
+}
+
+// decodeText 将整个文件内容转换为 UTF-8
+func decodeText(content []byte, name string) ([]byte, model.TextEncoding, error) {
+	r, enc, err := newDecodingReader(bytes.NewReader(content), name)
+	if err != nil {
+		return nil, enc, err
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, enc, fmt.Errorf("按 %s 解码失败: %w", enc.Name, err)
+	}
+	return text, enc, nil
+}
+
+// encodeText 将 UTF-8 文本按原编码输出 (含 BOM)
+func encodeText(text []byte, enc model.TextEncoding) ([]byte, error) {
+	var buf bytes.Buffer
+	if enc.BOM {
+		buf.Write(bomOf(enc))
+	}
+	if e := codecOf(enc); e != nil {
+		encoded, _, err := transform.Bytes(e.NewEncoder(), text)
+		if err != nil {
+			return nil, fmt.Errorf("按 %s 编码失败: %w", enc.Name, err)
+		}
+		text = encoded
+	}
+	buf.Write(text)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+
+	"deviceParser/model"
+)
+
+const encodingSample = "DEVICE: 测试芯片\r\n" +
+	"LOT: A12345\r\n" +
+	"WAFER: 07\r\n" +
+	"操作员: 张三\r\n" +
+	"RowData: ___ 001 001 ___\r\n" +
+	"RowData: 001 005 ... 001\r\n"
+
+func encodeSample(t *testing.T, name string) []byte {
+	t.Helper()
+	var content []byte
+	var err error
+	switch name {
+	case "gbk":
+		content, err = simplifiedchinese.GBK.NewEncoder().Bytes([]byte(encodingSample))
+	case "utf-16le bom":
+		content, err = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte(encodingSample))
+	case "utf-16le":
+		content, err = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte(encodingSample))
+	case "utf-16be bom":
+		content, err = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder().Bytes([]byte(encodingSample))
+	case "utf-8 bom":
+		content = append(append([]byte(nil), utf8BOM...), encodingSample...)
+	default:
+		content = []byte(encodingSample)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestScanMapEncodings(t *testing.T) {
+	cases := []struct {
+		name string
+		want model.TextEncoding
+	}{
+		{"utf-8", model.TextEncoding{Name: EncodingUTF8}},
+		{"utf-8 bom", model.TextEncoding{Name: EncodingUTF8, BOM: true}},
+		{"gbk", model.TextEncoding{Name: EncodingGBK}},
+		{"utf-16le bom", model.TextEncoding{Name: EncodingUTF16LE, BOM: true}},
+		{"utf-16le", model.TextEncoding{Name: EncodingUTF16LE}},
+		{"utf-16be bom", model.TextEncoding{Name: EncodingUTF16BE, BOM: true}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			scan, err := ScanReader("m.txt", bytes.NewReader(encodeSample(t, tc.name)), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scan.Encoding != tc.want {
+				t.Errorf("encoding = %+v, want %+v", scan.Encoding, tc.want)
+			}
+			if err := scan.Err(); err != nil {
+				t.Fatal(err)
+			}
+			result := scan.Results[0]
+			if result.Lot != "A12345" || result.Wafer != "07" {
+				t.Errorf("header = %q %q", result.Lot, result.Wafer)
+			}
+			if want := map[string]string{"DEVICE": "测试芯片", "操作员": "张三"}; !reflect.DeepEqual(result.Metadata, want) {
+				t.Errorf("metadata = %v, want %v", result.Metadata, want)
+			}
+			if want := map[string]int{"001": 4, "005": 1}; !reflect.DeepEqual(result.Counts, want) {
+				t.Errorf("counts = %v, want %v", result.Counts, want)
+			}
+			if len(scan.Diagnostics) != 0 {
+				t.Errorf("diagnostics = %v", scan.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestScanMapExplicitEncoding(t *testing.T) {
+	// 自动检测可能误判时，映射配置可以直接指定编码
+	content := encodeSample(t, "gbk")
+	scan, err := ScanReader("m.txt", bytes.NewReader(content), Options{Encoding: EncodingGBK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := scan.Results[0].Metadata["操作员"]; got != "张三" {
+		t.Errorf("metadata = %v", scan.Results[0].Metadata)
+	}
+	if err := ValidateEncoding("latin1"); err == nil {
+		t.Error("ValidateEncoding accepted latin1")
+	}
+}
+
+func TestWaferMapEncodingRoundTrip(t *testing.T) {
+	for _, name := range []string{"gbk", "utf-16le bom", "utf-8 bom"} {
+		t.Run(name, func(t *testing.T) {
+			content := encodeSample(t, name)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "in.txt")
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := ReadWaferMap(path, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Lot != "A12345" || m.Header[0] != "DEVICE: 测试芯片" {
+				t.Errorf("parsed = %q %q", m.Lot, m.Header)
+			}
+			out := filepath.Join(dir, "out.txt")
+			if err := WriteWaferMap(out, m); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("round trip changed content:\n got %x\nwant %x", got, content)
+			}
+		})
+	}
+}
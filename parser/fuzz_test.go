@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deviceParser/mapgen"
+	"deviceParser/model"
+)
+
+// addFuzzSeeds 以样本文件、合成 map 及几种编码变体作为模糊测试的种子
+func addFuzzSeeds(f *testing.F) {
+	files, _ := filepath.Glob(filepath.Join(corpusDir, "*.txt"))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(content)
+	}
+
+	opts := mapgen.DefaultOptions()
+	opts.Diameter = 60
+	opts.SkipRate = 0.05
+	opts.Patterns = []mapgen.Pattern{{Kind: mapgen.PatternCluster, Bin: "050"}, {Kind: mapgen.PatternEdge, Bin: "012", Density: 0.5}}
+	m, err := mapgen.Generate(opts)
+	if err != nil {
+		f.Fatal(err)
+	}
+	content := MarshalWaferMap(m)
+	f.Add(content)
+	f.Add(append(append([]byte{}, utf8BOM...), content...))
+	utf16, err := encodeText(content, model.TextEncoding{Name: EncodingUTF16LE, BOM: true})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(utf16)
+	f.Add([]byte("LOT: A\nWAFER: 1\nRowData: 001 ... ___\nWAFER: 2\nRowData:\nRowData: 0#1 002\r\n"))
+	f.Add([]byte("RowData: \x00 \xff\xfe 001\nLOT:\nWAFER:"))
+}
+
+// countTokens 按扫描器的规则独立统计解码后文本中 RowData 的非占位符 token 数量
+func countTokens(text []byte) int {
+	n := 0
+	sc := bufio.NewScanner(bytes.NewReader(text))
+	sc.Buffer(nil, maxLineBytes)
+	for sc.Scan() {
+		rest, ok := bytes.CutPrefix(bytes.TrimSpace(sc.Bytes()), rowDataPrefix)
+		if !ok {
+			continue
+		}
+		for _, tok := range bytes.FieldsFunc(rest, func(r rune) bool { return r < 0x80 && isSpace(byte(r)) }) {
+			if !model.IsPlaceholder(string(tok)) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// FuzzScanReader 任意内容都不能导致扫描器崩溃，且各片晶圆计数之和等于 RowData 中非占位符 token 的数量
+func FuzzScanReader(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, content []byte) {
+		scan, err := ScanReader("fuzz.txt", bytes.NewReader(content), Options{})
+		if err != nil {
+			return
+		}
+		total := 0
+		for i, r := range scan.Results {
+			for code, n := range r.Counts {
+				if n <= 0 || model.IsPlaceholder(code) {
+					t.Fatalf("result %d: invalid count %q=%d", i, code, n)
+				}
+				total += n
+			}
+			if len(scan.Results) > 1 && r.Block != i+1 {
+				t.Fatalf("result %d: block = %d", i, r.Block)
+			}
+		}
+
+		text, _, err := decodeText(content, "")
+		if err != nil {
+			t.Fatalf("scan succeeded but decode failed: %v", err)
+		}
+		if want := countTokens(text); total != want {
+			t.Fatalf("counts sum to %d, want %d non-placeholder tokens", total, want)
+		}
+		if scan.Err() == nil && !scan.HasData() {
+			t.Fatal("Err() is nil for a scan without data")
+		}
+	})
+}
+
+// FuzzWaferMapRoundTrip 读取得到的网格序列化后重新扫描，计数与网格一致
+func FuzzWaferMapRoundTrip(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, content []byte) {
+		path := filepath.Join(t.TempDir(), "fuzz.txt")
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		maps, err := ReadWaferMaps(path, Options{})
+		if err != nil {
+			return
+		}
+		for i, m := range maps {
+			scan, err := ScanReader("fuzz.txt", bytes.NewReader(MarshalWaferMap(m)), Options{Encoding: EncodingUTF8})
+			if err != nil {
+				t.Fatalf("map %d: rescan failed: %v", i, err)
+			}
+			got := make(map[string]int)
+			for _, r := range scan.Results {
+				for code, n := range r.Counts {
+					got[code] += n
+				}
+			}
+			want := m.Counts()
+			if len(got) != len(want) {
+				t.Fatalf("map %d: counts = %v, want %v", i, got, want)
+			}
+			for code, n := range want {
+				if got[code] != n {
+					t.Fatalf("map %d: counts = %v, want %v", i, got, want)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deviceParser/model"
+)
+
+// update 为 true 时用当前输出覆盖 golden 文件：go test ./parser -update
+var update = flag.Bool("update", false, "用当前输出覆盖 golden 文件")
+
+// corpusDir 解析与报表测试共用的 map 文件样本
+const corpusDir = "../testdata/maps"
+
+// goldenResult 单片晶圆提取结果中需要固定的字段
+type goldenResult struct {
+	FileName   string            `json:"fileName"`
+	Lot        string            `json:"lot"`
+	Wafer      string            `json:"wafer"`
+	Block      int               `json:"block,omitempty"`
+	Counts     map[string]int    `json:"counts"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	SourceHash string            `json:"sourceHash"`
+}
+
+// goldenFile 单个样本文件的提取结果、处理记录及校验问题
+type goldenFile struct {
+	Status      model.FileStatus `json:"status"`
+	Detail      string           `json:"detail,omitempty"`
+	Results     []goldenResult   `json:"results"`
+	Diagnostics []string         `json:"diagnostics,omitempty"`
+}
+
+func TestGoldenExtract(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(corpusDir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("%s 中没有样本文件", corpusDir)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			results, outcome, _ := Extract(path.Join(corpusDir, name), Options{})
+			got := goldenFile{Status: outcome.Status, Detail: outcome.Detail, Results: []goldenResult{}}
+			for _, r := range results {
+				got.Results = append(got.Results, goldenResult{
+					FileName:   r.FileName,
+					Lot:        r.Lot,
+					Wafer:      r.Wafer,
+					Block:      r.Block,
+					Counts:     r.Counts,
+					Metadata:   r.Metadata,
+					SourceHash: r.SourceHash,
+				})
+			}
+			for _, d := range outcome.Diagnostics {
+				got.Diagnostics = append(got.Diagnostics, d.String())
+			}
+			content, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join("testdata", "golden", strings.TrimSuffix(name, ".txt")+".json"), append(content, '\n'))
+		})
+	}
+}
+
+// checkGolden 将输出与 golden 文件比较，-update 时改为写入 golden 文件
+func checkGolden(t *testing.T, goldenPath string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("读取 golden 文件失败 (可使用 -update 生成): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("输出与 %s 不一致 (确认改动无误后使用 -update 更新):\n--- got\n%s\n--- want\n%s", goldenPath, got, want)
+	}
+}
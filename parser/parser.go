@@ -0,0 +1,156 @@
+// Package parser 读取 RowData 格式的 map 文件 (含压缩包中的文件及 GBK、UTF-16 编码)，
+// 单次扫描完成计数、头部提取、哈希计算及格式校验，并可保留行列结构按原格式写回
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"deviceParser/model"
+)
+
+var (
+	ErrMissingLotWafer = errors.New("文件中缺少 LOT 或 WAFER")
+	ErrMalformedRow    = errors.New("RowData 格式错误")
+	ErrValidation      = errors.New("文件校验未通过")
+)
+
+// Options 解析参数，零值表示自动检测编码、非严格模式
+type Options struct {
+	Encoding string // map 文件编码 (auto/utf-8/gbk/utf-16le/utf-16be)，为空时自动检测
+	Strict   bool   // RowData 结构错误、缺少 LOT/WAFER 及其他错误级别问题的文件记为失败；为 false 时只记入 Diagnostics，结果照常保留
+
+	Archives *Archives // 批次中共用的已打开压缩包，为 nil 时每次读取压缩包中的文件都重新打开
+}
+
+// ScanFile 打开并扫描单个文件 (可以是压缩包中的文件)
+func ScanFile(filePath string, opts Options) (Scan, error) {
+	f, err := opts.Archives.Open(filePath)
+	if err != nil {
+		return Scan{}, fmt.Errorf("读取文件失败: %w", err)
+	}
+	defer f.Close()
+	scan, err := ScanReader(SourceName(filePath), f, opts)
+	if err != nil {
+		return Scan{}, fmt.Errorf("读取文件失败: %w", err)
+	}
+	for i := range scan.Results {
+		scan.Results[i].SourcePath = filePath
+	}
+	return scan, nil
+}
+
+// ParseFile 只负责从单个文件中提取数据，以流式方式逐行读取，超大文件也不会整体载入内存
+// 文件中有多个 LOT/WAFER 块时每块返回一个结果
+func ParseFile(filePath string, opts Options) ([]model.FileResult, error) {
+	scan, err := ScanFile(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return scan.Results, scan.Err()
+}
+
+// Keys 返回文件中出现的全部 bin 编号 (已排序)，与计数在同一次扫描中得到
+func Keys(filePath string, opts Options) ([]string, error) {
+	scan, err := ScanFile(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := make(map[string]struct{})
+	for _, result := range scan.Results {
+		for k := range result.Counts {
+			keySet[k] = struct{}{}
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// ValidateFile 读取并校验单个文件
+func ValidateFile(filePath string, opts Options) ([]model.Diagnostic, error) {
+	scan, err := ScanFile(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return scan.Diagnostics, nil
+}
+
+// ValidateContent 校验文件内容：LOT/WAFER 缺失或重复、RowData 列数不一致、无法识别的 token 及行
+func ValidateContent(name string, content []byte) []model.Diagnostic {
+	scan, _ := ScanReader(name, bytes.NewReader(content), Options{}) // 内存中的内容读取不会出错
+	return scan.Diagnostics
+}
+
+// Extract 一次读取完成校验与提取，返回文件中每片晶圆的结果、文件的处理记录及提取错误
+// opts.Strict 为 true 时存在错误级别问题的文件记为校验失败，返回 ErrValidation
+func Extract(filePath string, opts Options) ([]model.FileResult, model.FileOutcome, error) {
+	scan, err := ScanFile(filePath, opts)
+	if err != nil {
+		return nil, NewOutcome(filePath, nil, err), err
+	}
+	results := scan.Results
+	err = scan.Err()
+	outcome := NewOutcome(filePath, results, err)
+	outcome.Diagnostics = scan.Diagnostics
+	if warning := scan.Warning(); warning != nil {
+		detail := "已保留结果，" + warning.Error()
+		if outcome.Detail != "" {
+			detail = outcome.Detail + "；" + detail
+		}
+		outcome.Detail = detail
+	}
+	if err == nil && opts.Strict && model.HasErrors(scan.Diagnostics) {
+		err = ErrValidation
+		outcome.Status = model.StatusInvalid
+		for _, d := range scan.Diagnostics {
+			if d.Severity == model.SeverityError {
+				outcome.Detail = d.String()
+				break
+			}
+		}
+	}
+	return results, outcome, err
+}
+
+// NewOutcome 根据提取结果及错误生成处理记录，多晶圆文件列出其中全部 LOT 与 WAFER
+func NewOutcome(filePath string, results []model.FileResult, err error) model.FileOutcome {
+	o := model.FileOutcome{Path: filePath, Name: SourceName(filePath), Status: model.StatusOK}
+	var lots, wafers []string
+	for _, r := range results {
+		if !slices.Contains(lots, r.Lot) {
+			lots = append(lots, r.Lot)
+		}
+		wafers = append(wafers, r.Wafer)
+	}
+	o.Lot = strings.Join(lots, ",")
+	o.Wafer = strings.Join(wafers, ",")
+	if err == nil {
+		if len(results) > 1 {
+			o.Detail = fmt.Sprintf("包含 %d 片晶圆", len(results))
+		}
+		return o
+	}
+	o.Detail = err.Error()
+	switch {
+	case errors.Is(err, model.ErrNoData):
+		o.Status = model.StatusNoData
+		o.Detail = "文件中没有 RowData 数据"
+	case errors.Is(err, ErrMissingLotWafer):
+		o.Status = model.StatusMissingLotWafer
+	case errors.Is(err, ErrMalformedRow):
+		o.Status = model.StatusMalformedRow
+	default:
+		o.Status = model.StatusReadError
+	}
+	return o
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateMapContent(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "clean",
+			content: "LOT: A1\n" +
+				"WAFER: 01\n" +
+				"RowData: ___ 001 ___\n" +
+				"RowData: 001 002 ...\n",
+		},
+		{
+			name: "short row and unknown token",
+			content: "LOT: A1\n" +
+				"WAFER: 01\n" +
+				"RowData: 001 001 001\n" +
+				"RowData: 001 0?1\n" +
+				"RowData: 001 001 001\n",
+			want: []string{
+				"m.txt:4:2: 错误: 无法识别的 token \"0?1\"",
+				"m.txt:4: 错误: 该行有 2 个 die，应为 3",
+			},
+		},
+		{
+			name: "duplicate headers",
+			content: "LOT: A1\n" +
+				"DEVICE: X\n" +
+				"LOT: A2\n" +
+				"DEVICE: X\n" +
+				"garbage\n" +
+				"RowData: 001\n",
+			want: []string{
+				"m.txt:3: 错误: LOT 重复出现且与第 1 行不一致 (\"A1\" / \"A2\")",
+				"m.txt:4: 警告: DEVICE 与第 2 行重复",
+				"m.txt:5: 警告: 无法识别的行 \"garbage\"",
+				"m.txt: 错误: 缺少 WAFER",
+			},
+		},
+		{
+			name:    "no rows",
+			content: "LOT: A1\r\nWAFER:\r\n",
+			want: []string{
+				"m.txt:2: 错误: WAFER 为空",
+				"m.txt: 错误: 没有 RowData",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, d := range ValidateContent("m.txt", []byte(tc.content)) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("diagnostics:\n got %q\nwant %q", got, tc.want)
+			}
+		})
+	}
+}
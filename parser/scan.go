@@ -0,0 +1,351 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"deviceParser/model"
+)
+
+const (
+	// maxLineBytes 单行允许的最大长度，超大晶圆的 RowData 也远小于此值
+	maxLineBytes = 64 << 20
+	// maxDiagnostics 单个文件最多记录的校验问题数量，异常文件不会占用大量内存
+	maxDiagnostics = 200
+)
+
+var rowDataPrefix = []byte("RowData:")
+
+// mapScanner 逐行读取 map 文件的流式分词器，内存占用与文件大小无关
+type mapScanner struct {
+	sc      *bufio.Scanner
+	LineNum int
+	Line    []byte // 去掉首尾空白的当前行，仅在下一次 Scan 之前有效
+}
+
+func newMapScanner(r io.Reader) *mapScanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineBytes)
+	return &mapScanner{sc: sc}
+}
+
+// Scan 读取下一行 (兼容 CRLF)
+func (s *mapScanner) Scan() bool {
+	if !s.sc.Scan() {
+		return false
+	}
+	s.LineNum++
+	s.Line = bytes.TrimSpace(s.sc.Bytes())
+	return true
+}
+
+// Err 返回读取过程中的错误
+func (s *mapScanner) Err() error {
+	return s.sc.Err()
+}
+
+// nextToken 返回 b 中的第一个以空白分隔的 token 及其后的剩余部分，没有 token 时 tok 为空
+func nextToken(b []byte) (tok, rest []byte) {
+	i := 0
+	for i < len(b) && isSpace(b[i]) {
+		i++
+	}
+	j := i
+	for j < len(b) && !isSpace(b[j]) {
+		j++
+	}
+	return b[i:j], b[j:]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+// isBinToken 判断 token 是否为合法的 bin 编号：只包含字母或数字
+func isBinToken(tok []byte) bool {
+	if len(tok) == 0 {
+		return false
+	}
+	for _, c := range tok {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// rowRun 连续若干行列数相同的 RowData，只记录行段而不是每一行，内存不随行数增长
+type rowRun struct {
+	firstLine, width, n int
+}
+
+// Scan 单次扫描得到的全部信息：每片晶圆的计数 (其键即全部 bin 编号)、头部信息、哈希及校验问题
+type Scan struct {
+	Results     []model.FileResult // 文件中每个 LOT/WAFER 块一个结果，按出现顺序排列，没有 RowData 的块不计入
+	SourceHash  string             // 整个文件原始内容的 SHA-256
+	Diagnostics []model.Diagnostic
+	RowErr      error              // 第一处 RowData 结构错误 (空行或列数不一致)，包装 ErrMalformedRow
+	Encoding    model.TextEncoding // 检测到或指定的文件编码
+
+	missingLotWafer bool // 存在有数据但缺少 LOT 或 WAFER 的块
+	strict          bool // 扫描时的 Options.Strict
+}
+
+// Err 返回提取数据时应报告的错误，顺序与校验的严重程度一致
+// 非严格模式下 RowData 结构错误及缺少 LOT/WAFER 不算错误，结果照常保留，见 Warning
+func (s Scan) Err() error {
+	switch {
+	case s.strict && s.RowErr != nil:
+		return s.RowErr
+	case !s.HasData():
+		return model.ErrNoData
+	case s.strict && s.missingLotWafer:
+		return ErrMissingLotWafer
+	}
+	return nil
+}
+
+// Warning 返回非严格模式下被容忍的问题 (RowData 结构错误或缺少 LOT/WAFER)，用于在处理记录中提示
+func (s Scan) Warning() error {
+	if s.strict || !s.HasData() {
+		return nil
+	}
+	switch {
+	case s.RowErr != nil:
+		return s.RowErr
+	case s.missingLotWafer:
+		return ErrMissingLotWafer
+	}
+	return nil
+}
+
+// HasData 判断是否至少有一片晶圆含有 bin 数据 (RowData 全为占位符时没有数据)
+func (s Scan) HasData() bool {
+	for _, r := range s.Results {
+		if len(r.Counts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mapBlock 扫描过程中单个 LOT/WAFER 块的状态
+type mapBlock struct {
+	result    model.FileResult
+	startLine int
+
+	// 计数时以 string(tok) 查找已有编号不会分配内存，只有新编号才需要分配
+	counters map[string]*int
+
+	runs          []rowRun
+	widthCounts   map[int]int
+	expected      int // 出现次数最多的列数 (相同时取先出现的)
+	firstEmptyRow int // 第一行空 RowData 的行号
+	headerLines   map[string]int
+	headerValues  map[string]string
+}
+
+// newMapBlock 开始新的块，LOT 及其余头部信息沿用上一块，WAFER 必须在每块中给出
+func newMapBlock(prev *mapBlock, name string, line int) *mapBlock {
+	b := &mapBlock{
+		result:       model.FileResult{FileName: name, Counts: make(map[string]int), Metadata: make(map[string]string)},
+		startLine:    line,
+		counters:     make(map[string]*int),
+		widthCounts:  make(map[int]int),
+		headerLines:  make(map[string]int),
+		headerValues: make(map[string]string),
+	}
+	if prev != nil {
+		b.result.Lot = prev.result.Lot
+		for k, v := range prev.result.Metadata {
+			b.result.Metadata[k] = v
+		}
+	}
+	return b
+}
+
+func (b *mapBlock) count(tok []byte) {
+	if n := b.counters[string(tok)]; n != nil {
+		*n++
+		return
+	}
+	n := 1
+	b.counters[string(tok)] = &n
+}
+
+// hasRows 判断块中是否已经出现过 RowData
+func (b *mapBlock) hasRows() bool {
+	return len(b.runs) > 0 || b.firstEmptyRow > 0
+}
+
+// ScanReader 单次流式读取 map 内容，同时完成计数、头部提取、哈希计算及格式校验
+// 内容按 opts.Encoding 转换为 UTF-8 后再解析，哈希仍基于原始字节
+// 测试机合并导出的文件中含有多个 LOT/WAFER 块：RowData 之后再次出现 LOT 或 WAFER 时开始新的块，
+// 每块得到一个独立的结果
+// 只有读取本身出错时返回错误，内容上的问题记录在 Diagnostics 与 RowErr 中
+func ScanReader(name string, r io.Reader, opts Options) (Scan, error) {
+	hasher := sha256.New()
+	decoded, enc, err := newDecodingReader(io.TeeReader(r, hasher), opts.Encoding)
+	if err != nil {
+		return Scan{}, err
+	}
+	s := newMapScanner(decoded)
+
+	scan := Scan{Encoding: enc, strict: opts.Strict}
+	dropped := 0
+	report := func(line, column int, sev model.Severity, format string, args ...interface{}) {
+		if len(scan.Diagnostics) >= maxDiagnostics {
+			dropped++
+			return
+		}
+		scan.Diagnostics = append(scan.Diagnostics, model.Diagnostic{File: name, Line: line, Column: column, Severity: sev, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var blocks []*mapBlock
+	block := newMapBlock(nil, name, 0)
+	rowErrLine := 0
+	// finish 在块结束时检查列数并记录块级问题，列数不一致的行在读完整个块后才能确定
+	finish := func(b *mapBlock) {
+		firstBadRow := 0
+		var rowErr error
+		for _, run := range b.runs {
+			if run.width == b.expected {
+				continue
+			}
+			if firstBadRow == 0 {
+				firstBadRow = run.firstLine
+				rowErr = fmt.Errorf("第 %d 行: %w: 有 %d 个 die，应为 %d", run.firstLine, ErrMalformedRow, run.width, b.expected)
+			}
+			for line := run.firstLine; line < run.firstLine+run.n; line++ {
+				report(line, 0, model.SeverityError, "该行有 %d 个 die，应为 %d", run.width, b.expected)
+			}
+		}
+		if b.firstEmptyRow > 0 && (firstBadRow == 0 || b.firstEmptyRow < firstBadRow) {
+			firstBadRow = b.firstEmptyRow
+			rowErr = fmt.Errorf("第 %d 行: %w: 没有任何 die", b.firstEmptyRow, ErrMalformedRow)
+		}
+		if rowErr != nil && (rowErrLine == 0 || firstBadRow < rowErrLine) {
+			rowErrLine = firstBadRow
+			scan.RowErr = rowErr
+		}
+
+		// 块级问题不受数量上限限制，第一块之外的块标出起始行
+		for _, key := range []string{"LOT", "WAFER"} {
+			if _, ok := b.headerLines[key]; !ok && (key == "WAFER" || b.result.Lot == "") {
+				scan.Diagnostics = append(scan.Diagnostics, model.Diagnostic{File: name, Line: b.startLine, Severity: model.SeverityError, Message: "缺少 " + key})
+			}
+		}
+		if len(b.runs) == 0 {
+			scan.Diagnostics = append(scan.Diagnostics, model.Diagnostic{File: name, Line: b.startLine, Severity: model.SeverityError, Message: "没有 RowData"})
+		}
+		blocks = append(blocks, b)
+	}
+
+	for s.Scan() {
+		if len(s.Line) == 0 {
+			continue
+		}
+
+		if rest, ok := bytes.CutPrefix(s.Line, rowDataPrefix); ok {
+			width := 0
+			for tok, rest := nextToken(rest); len(tok) > 0; tok, rest = nextToken(rest) {
+				width++
+				switch {
+				case string(tok) == model.EmptyDie || string(tok) == model.SkippedDie:
+				case isBinToken(tok):
+					block.count(tok)
+				default:
+					report(s.LineNum, width, model.SeverityError, "无法识别的 token %q", tok)
+					block.count(tok)
+				}
+			}
+			if width == 0 {
+				report(s.LineNum, 0, model.SeverityError, "RowData 中没有任何 die")
+				if block.firstEmptyRow == 0 {
+					block.firstEmptyRow = s.LineNum
+				}
+				continue
+			}
+
+			if last := len(block.runs) - 1; last >= 0 && block.runs[last].width == width && block.runs[last].firstLine+block.runs[last].n == s.LineNum {
+				block.runs[last].n++
+			} else {
+				block.runs = append(block.runs, rowRun{firstLine: s.LineNum, width: width, n: 1})
+			}
+			block.widthCounts[width]++
+			if block.expected == 0 || block.widthCounts[width] > block.widthCounts[block.expected] {
+				block.expected = width
+			}
+			continue
+		}
+
+		rawKey, rawValue, ok := bytes.Cut(s.Line, []byte(":"))
+		key := string(bytes.TrimSpace(rawKey))
+		if !ok || key == "" {
+			report(s.LineNum, 0, model.SeverityWarning, "无法识别的行 %q", s.Line)
+			continue
+		}
+		if (key == "LOT" || key == "WAFER") && block.hasRows() {
+			finish(block)
+			block = newMapBlock(block, name, s.LineNum)
+		}
+		value := string(bytes.TrimSpace(rawValue))
+		switch key {
+		case "LOT":
+			block.result.Lot = value
+		case "WAFER":
+			block.result.Wafer = value
+		default:
+			// 其余 "键: 值" 形式的头部信息 (如 DEVICE、TEST DATE) 作为元数据保留
+			block.result.Metadata[key] = value
+		}
+		if first, seen := block.headerLines[key]; seen {
+			if (key == "LOT" || key == "WAFER") && block.headerValues[key] != value {
+				report(s.LineNum, 0, model.SeverityError, "%s 重复出现且与第 %d 行不一致 (%q / %q)", key, first, block.headerValues[key], value)
+			} else {
+				report(s.LineNum, 0, model.SeverityWarning, "%s 与第 %d 行重复", key, first)
+			}
+			continue
+		}
+		block.headerLines[key] = s.LineNum
+		block.headerValues[key] = value
+		if (key == "LOT" || key == "WAFER") && value == "" {
+			report(s.LineNum, 0, model.SeverityError, "%s 为空", key)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return Scan{}, err
+	}
+	finish(block)
+	if dropped > 0 {
+		scan.Diagnostics = append(scan.Diagnostics, model.Diagnostic{File: name, Severity: model.SeverityWarning, Message: fmt.Sprintf("另有 %d 个问题未列出", dropped)})
+	}
+
+	scan.SourceHash = hex.EncodeToString(hasher.Sum(nil))
+	for _, b := range blocks {
+		if len(b.runs) == 0 {
+			continue
+		}
+		for code, n := range b.counters {
+			b.result.Counts[code] = *n
+		}
+		if b.result.Lot == "" || b.result.Wafer == "" {
+			scan.missingLotWafer = true
+		}
+		scan.Results = append(scan.Results, b.result)
+	}
+	for i := range scan.Results {
+		scan.Results[i].SourceHash = scan.SourceHash
+		if len(scan.Results) > 1 {
+			// 同一文件中的各片晶圆以块序号区分哈希，重复导入同一文件时哈希保持不变
+			scan.Results[i].Block = i + 1
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", scan.SourceHash, i+1)))
+			scan.Results[i].SourceHash = hex.EncodeToString(sum[:])
+		}
+	}
+	return scan, nil
+}
@@ -0,0 +1,245 @@
+package parser
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"deviceParser/model"
+)
+
+func TestExtractDataFromFile(t *testing.T) {
+	content := "DEVICE: XYZ-100\r\n" +
+		"LOT: A12345\r\n" +
+		"WAFER: 07\r\n" +
+		"TEST DATE: 2024-05-01 10:20:30\r\n" +
+		"RowData: ___ 001 001 ___\r\n" +
+		"RowData: 001 005 ... 001\r\n"
+	path := writeTempMap(t, "a.txt", content)
+
+	results, err := ParseFile(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	result := results[0]
+	if result.Block != 0 {
+		t.Errorf("block = %d, want 0", result.Block)
+	}
+	if result.Lot != "A12345" || result.Wafer != "07" || result.FileName != "a.txt" || result.SourcePath != path {
+		t.Errorf("header = %q %q %q %q", result.Lot, result.Wafer, result.FileName, result.SourcePath)
+	}
+	if want := map[string]int{"001": 4, "005": 1}; !reflect.DeepEqual(result.Counts, want) {
+		t.Errorf("counts = %v, want %v", result.Counts, want)
+	}
+	if want := map[string]string{"DEVICE": "XYZ-100", "TEST DATE": "2024-05-01 10:20:30"}; !reflect.DeepEqual(result.Metadata, want) {
+		t.Errorf("metadata = %v, want %v", result.Metadata, want)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if result.SourceHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash = %s", result.SourceHash)
+	}
+
+	keys, err := Keys(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"001", "005"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestExtractDataFromFileErrors(t *testing.T) {
+	// 非严格模式下结构问题只作提示，有数据的文件照常返回结果
+	cases := []struct {
+		name    string
+		content string
+		strict  error
+		lenient error
+	}{
+		{"no data", "LOT: A\nWAFER: 1\n", model.ErrNoData, model.ErrNoData},
+		{"missing wafer", "LOT: A\nRowData: 001\n", ErrMissingLotWafer, nil},
+		{"ragged", "LOT: A\nWAFER: 1\nRowData: 001 001\nRowData: 001\nRowData: 001 001\n", ErrMalformedRow, nil},
+		{"empty row", "LOT: A\nWAFER: 1\nRowData:\n", ErrMalformedRow, model.ErrNoData},
+		{"empty row with data", "LOT: A\nWAFER: 1\nRowData: 001\nRowData:\n", ErrMalformedRow, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeTempMap(t, "m.txt", tc.content)
+			if _, err := ParseFile(path, Options{Strict: true}); !errors.Is(err, tc.strict) {
+				t.Errorf("strict: err = %v, want %v", err, tc.strict)
+			}
+			results, err := ParseFile(path, Options{})
+			if !errors.Is(err, tc.lenient) {
+				t.Errorf("lenient: err = %v, want %v", err, tc.lenient)
+			}
+			if tc.lenient == nil && len(results) == 0 {
+				t.Error("lenient: results were dropped")
+			}
+
+			_, outcome, err := Extract(path, Options{})
+			if tc.lenient == nil && (err != nil || !outcome.OK() || !strings.Contains(outcome.Detail, tc.strict.Error())) {
+				t.Errorf("lenient outcome = %+v, %v", outcome, err)
+			}
+		})
+	}
+}
+
+func TestExtractMultiWaferFile(t *testing.T) {
+	content := "DEVICE: XYZ-100\n" +
+		"LOT: A12345\n" +
+		"WAFER: 01\n" +
+		"RowData: 001 005\n" +
+		"RowData: 001 001\n" +
+		"WAFER: 02\n" +
+		"TEST DATE: 2024-05-02 08:00:00\n" +
+		"RowData: 005 005 001\n" +
+		"LOT: B00001\n" +
+		"WAFER: 01\n" +
+		"RowData: 001\n"
+	path := writeTempMap(t, "multi.txt", content)
+
+	results, err := ParseFile(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	hashes := make(map[string]bool)
+	for _, r := range results {
+		got = append(got, fmt.Sprintf("%d %s-%s %v %s", r.Block, r.Lot, r.Wafer, r.Counts, r.Metadata["DEVICE"]))
+		hashes[r.SourceHash] = true
+	}
+	want := []string{
+		"1 A12345-01 map[001:3 005:1] XYZ-100",
+		"2 A12345-02 map[001:1 005:2] XYZ-100",
+		"3 B00001-01 map[001:1] XYZ-100",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results:\n got %q\nwant %q", got, want)
+	}
+	if len(hashes) != 3 {
+		t.Errorf("block hashes are not distinct: %v", hashes)
+	}
+	if diags := ValidateContent("multi.txt", []byte(content)); len(diags) != 0 {
+		t.Errorf("diagnostics = %v", diags)
+	}
+
+	maps, err := ReadWaferMaps(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != 3 || maps[1].Wafer != "02" || maps[1].Block != 2 || len(maps[1].Rows) != 1 {
+		t.Fatalf("maps = %+v", maps)
+	}
+	if got, want := string(MarshalWaferMap(maps[1])), "LOT: A12345\nWAFER: 02\nTEST DATE: 2024-05-02 08:00:00\nRowData: 005 005 001\n"; got != want {
+		t.Errorf("block 2 = %q, want %q", got, want)
+	}
+	if m, err := LoadWaferMap(results[2], Options{}); err != nil || m.Lot != "B00001" {
+		t.Errorf("loadWaferMap = %+v, %v", m, err)
+	}
+
+	_, err = ParseFile(writeTempMap(t, "m.txt", "LOT: A\nWAFER: 01\nRowData: 001\nLOT: B\nRowData: 001\n"), Options{Strict: true})
+	if !errors.Is(err, ErrMissingLotWafer) {
+		t.Errorf("err = %v, want %v", err, ErrMissingLotWafer)
+	}
+}
+
+func TestExtractMultiWaferEmptyBlock(t *testing.T) {
+	// 第二块只有空 RowData，不算一片晶圆，计数结果与网格的块编号保持一致
+	content := "LOT: A1\n" +
+		"WAFER: 01\n" +
+		"RowData: 001 005\n" +
+		"WAFER: 02\n" +
+		"RowData:\n" +
+		"RowData:   \n" +
+		"WAFER: 03\n" +
+		"RowData: 012 001\n" +
+		"WAFER: 04\n" +
+		"RowData:\n"
+	path := writeTempMap(t, "multi.txt", content)
+
+	results, err := ParseFile(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	maps, err := ReadWaferMaps(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || len(maps) != 2 {
+		t.Fatalf("results = %d, maps = %d, want 2", len(results), len(maps))
+	}
+	for i, r := range results {
+		m, err := LoadWaferMap(r, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Block != r.Block || m.Wafer != r.Wafer || maps[i].Wafer != r.Wafer || !reflect.DeepEqual(m.Counts(), r.Counts) {
+			t.Errorf("block %d: map %s (%d) %v, result %s %v", r.Block, m.Wafer, m.Block, m.Counts(), r.Wafer, r.Counts)
+		}
+	}
+	if results[1].Wafer != "03" || results[1].Block != 2 {
+		t.Errorf("second result = %s (block %d), want 03 (block 2)", results[1].Wafer, results[1].Block)
+	}
+}
+
+// writeLargeMap 生成约 size 字节的 map 文件，每行 400 个 die
+func writeLargeMap(b *testing.B, size int) string {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "large.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "LOT: BENCH\nWAFER: 01\nTEST DATE: 2024-05-01 10:20:30\n")
+	tokens := []string{"001", "001", "001", "005", "001", "___", "012", "001", "...", "001"}
+	written := 0
+	for row := 0; written < size; row++ {
+		n, _ := w.WriteString("RowData:")
+		written += n
+		for i := 0; i < 400; i++ {
+			n, _ := w.WriteString(" " + tokens[(row+i)%len(tokens)])
+			written += n
+		}
+		w.WriteByte('\n')
+		written++
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// BenchmarkParseFile 不同大小的输入下每次提取分配的内存 (B/op) 基本不变
+func BenchmarkParseFile(b *testing.B) {
+	for _, mb := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("%dMB", mb), func(b *testing.B) {
+			path := writeLargeMap(b, mb<<20)
+			fileInfo, err := os.Stat(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(fileInfo.Size())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ParseFile(path, Options{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
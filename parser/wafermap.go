@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"deviceParser/model"
+)
+
+// ReadWaferMaps 读取文件并保留 RowData 的行列结构，文件编码按 opts.Encoding 处理
+// 与 ScanReader 相同，RowData 之后再次出现 LOT 或 WAFER 时开始新的晶圆，每块的头部与尾部行只属于该块，
+// 写回时每块成为一个独立的文件
+func ReadWaferMaps(filePath string, opts Options) ([]model.WaferMap, error) {
+	content, err := readSource(filePath, opts.Archives)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	decoded, enc, err := decodeText(content, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	m := model.WaferMap{FileName: SourceName(filePath), LineEnding: "\n", Encoding: enc}
+	text := string(decoded)
+	if strings.Contains(text, "\r\n") {
+		m.LineEnding = "\r\n"
+	}
+
+	var maps []model.WaferMap
+	// 每行连同其换行符保存在 Lines 中，混用换行符及末尾没有换行符的文件也能按原样写回
+	for _, raw := range strings.SplitAfter(text, "\n") {
+		if raw == "" {
+			continue
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(raw, "\n"), "\r")
+		cleanLine := strings.TrimSpace(line)
+		if strings.HasPrefix(cleanLine, "RowData:") {
+			m.Rows = append(m.Rows, strings.Fields(strings.TrimPrefix(cleanLine, "RowData:")))
+			m.Lines = append(m.Lines, raw)
+			continue
+		}
+
+		lot, isLot := headerValue(line, "LOT:")
+		wafer, isWafer := headerValue(line, "WAFER:")
+		if (isLot || isWafer) && len(m.Rows) > 0 {
+			if hasDies(m.Rows) {
+				maps = append(maps, m)
+			}
+			m = model.WaferMap{FileName: m.FileName, Lot: m.Lot, LineEnding: m.LineEnding, Encoding: m.Encoding}
+		}
+		if isLot {
+			m.Lot = lot
+		} else if isWafer {
+			m.Wafer = wafer
+		}
+		if len(m.Rows) == 0 {
+			m.Header = append(m.Header, line)
+		} else {
+			m.Trailer = append(m.Trailer, line)
+		}
+		m.Lines = append(m.Lines, raw)
+	}
+	if hasDies(m.Rows) {
+		maps = append(maps, m)
+	}
+
+	if len(maps) == 0 {
+		return nil, model.ErrNoData
+	}
+	if len(maps) > 1 {
+		for i := range maps {
+			maps[i].Block = i + 1
+		}
+	}
+	return maps, nil
+}
+
+// hasDies 判断块中是否至少有一行非空的 RowData；与 ScanReader 一致，只有空 RowData 的块不算一片晶圆，
+// 不参与块编号，保证网格与计数结果按 Block 一一对应
+func hasDies(rows [][]string) bool {
+	return slices.ContainsFunc(rows, func(row []string) bool { return len(row) > 0 })
+}
+
+// ReadWaferMap 读取只含一片晶圆的文件，多晶圆文件请使用 ReadWaferMaps
+func ReadWaferMap(filePath string, opts Options) (model.WaferMap, error) {
+	maps, err := ReadWaferMaps(filePath, opts)
+	if err != nil {
+		return model.WaferMap{}, err
+	}
+	if len(maps) > 1 {
+		return model.WaferMap{}, fmt.Errorf("%s 包含 %d 片晶圆", maps[0].FileName, len(maps))
+	}
+	return maps[0], nil
+}
+
+// LoadWaferMap 重新读取结果对应的网格，多晶圆文件取结果所在的块
+func LoadWaferMap(result model.FileResult, opts Options) (model.WaferMap, error) {
+	maps, err := ReadWaferMaps(result.SourcePath, opts)
+	if err != nil {
+		return model.WaferMap{}, err
+	}
+	i := max(result.Block, 1) - 1
+	if i >= len(maps) {
+		return model.WaferMap{}, fmt.Errorf("%s 中没有第 %d 片晶圆", maps[0].FileName, result.Block)
+	}
+	return maps[i], nil
+}
+
+// headerValue 若 line 是以 prefix 开头的头部行，返回其取值
+func headerValue(line string, prefix string) (string, bool) {
+	cleanLine := strings.TrimSpace(line)
+	if !strings.HasPrefix(cleanLine, prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(cleanLine, prefix)), true
+}
+
+// isLotLine 判断是否为 LOT 头部行
+func isLotLine(line string) bool {
+	_, ok := headerValue(line, "LOT:")
+	return ok
+}
+
+// MarshalWaferMap 将网格序列化为原始文本格式，返回 UTF-8 文本
+// 从文件读取的 map 按原始行逐行输出：未修改的行保持原样 (含间距、换行符及尾部行的位置)，
+// 只重新生成内容被修改的 RowData 行，以及 Lot/Wafer 被修改过的 LOT/WAFER 行；
+// 在内存中新建或行数被改变的 map 按头部行 + RowData 行 + 尾部行生成
+func MarshalWaferMap(m model.WaferMap) []byte {
+	eol := m.LineEnding
+	if eol == "" {
+		eol = "\n"
+	}
+
+	var buf bytes.Buffer
+	if len(m.Lines) > 0 && countRowLines(m.Lines) == len(m.Rows) {
+		if m.Lot != "" && !slices.ContainsFunc(m.Lines, isLotLine) {
+			// 多晶圆文件中沿用上一片 LOT 的块，单独写出时补上 LOT 行
+			buf.WriteString("LOT: " + m.Lot + eol)
+		}
+		row := 0
+		for _, raw := range m.Lines {
+			line := strings.TrimRight(raw, "\r\n")
+			lineEOL := raw[len(line):]
+			if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "RowData:"); ok {
+				if !slices.Equal(strings.Fields(rest), m.Rows[row]) {
+					line = "RowData: " + strings.Join(m.Rows[row], " ")
+				}
+				row++
+			} else {
+				line = rewriteHeaderLine(line, m)
+			}
+			buf.WriteString(line + lineEOL)
+		}
+		return buf.Bytes()
+	}
+
+	header := m.Header
+	if len(header) == 0 {
+		header = []string{"LOT: " + m.Lot, "WAFER: " + m.Wafer}
+	} else if m.Lot != "" && !slices.ContainsFunc(header, isLotLine) {
+		header = append([]string{"LOT: " + m.Lot}, header...)
+	}
+	for _, line := range header {
+		buf.WriteString(rewriteHeaderLine(line, m) + eol)
+	}
+	for _, row := range m.Rows {
+		buf.WriteString("RowData: " + strings.Join(row, " ") + eol)
+	}
+	for _, line := range m.Trailer {
+		buf.WriteString(line + eol)
+	}
+	return buf.Bytes()
+}
+
+// countRowLines 返回原始行中 RowData 行的数量
+func countRowLines(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "RowData:") {
+			n++
+		}
+	}
+	return n
+}
+
+// rewriteHeaderLine Lot/Wafer 被修改过时重写对应的 LOT/WAFER 行，其余行原样返回
+func rewriteHeaderLine(line string, m model.WaferMap) string {
+	if v, ok := headerValue(line, "LOT:"); ok && v != m.Lot {
+		return "LOT: " + m.Lot
+	}
+	if v, ok := headerValue(line, "WAFER:"); ok && v != m.Wafer {
+		return "WAFER: " + m.Wafer
+	}
+	return line
+}
+
+// WriteWaferMap 将网格按原始文本格式及原编码写回磁盘，可直接交给探针台使用
+func WriteWaferMap(outputFilePath string, m model.WaferMap) error {
+	content, err := encodeText(MarshalWaferMap(m), m.Encoding)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFilePath, content, 0644); err != nil {
+		return fmt.Errorf("保存到磁盘失败: %w", err)
+	}
+	return nil
+}
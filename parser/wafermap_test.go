@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"deviceParser/model"
+)
+
+func writeTempMap(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWaferMapRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "basic",
+			content: "LOT: A12345\n" +
+				"WAFER: 07\n" +
+				"RowData: ___ ___ 001 001 ___ ___\n" +
+				"RowData: ___ 001 002 001 ... ___\n" +
+				"RowData: 001 001 001 015 001 001\n" +
+				"RowData: ___ ___ 001 001 ___ ___\n",
+		},
+		{
+			name: "extra header and trailer",
+			content: "DEVICE: XYZ-100\n" +
+				"LOT: A12345\n" +
+				"WAFER: 08\n" +
+				"TEST DATE: 2024-05-01 10:20:30\n" +
+				"\n" +
+				"RowData: ___ 001 ___\n" +
+				"RowData: 003 001 ...\n" +
+				"END\n",
+		},
+		{
+			name: "crlf",
+			content: "LOT: B0001\r\n" +
+				"WAFER: 12\r\n" +
+				"RowData: ___ 001 ___\r\n" +
+				"RowData: 001 002 001\r\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, err := ReadWaferMap(writeTempMap(t, "in.txt", tc.content), Options{})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			out := filepath.Join(t.TempDir(), "in.txt")
+			if err := WriteWaferMap(out, first); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			written, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(written) != tc.content {
+				t.Errorf("written content differs\ngot:\n%q\nwant:\n%q", written, tc.content)
+			}
+
+			second, err := ReadWaferMap(out, Options{})
+			if err != nil {
+				t.Fatalf("re-parse: %v", err)
+			}
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("round trip is lossy\nfirst:  %+v\nsecond: %+v", first, second)
+			}
+		})
+	}
+}
+
+func TestWriteWaferMapWithoutHeader(t *testing.T) {
+	m := model.WaferMap{
+		Lot:   "C777",
+		Wafer: "03",
+		Rows:  [][]string{{"___", "001", "___"}, {"002", "001", "..."}},
+	}
+	out := filepath.Join(t.TempDir(), "new.txt")
+	if err := WriteWaferMap(out, m); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadWaferMap(out, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Lot != m.Lot || got.Wafer != m.Wafer || !reflect.DeepEqual(got.Rows, m.Rows) {
+		t.Errorf("got %+v, want %+v", got, m)
+	}
+}
+
+func TestWriteWaferMapRewritesEditedHeader(t *testing.T) {
+	m, err := ReadWaferMap(writeTempMap(t, "in.txt", "LOT:   A1\nWAFER: 01\nRowData: 001\n"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Wafer = "02"
+
+	want := "LOT:   A1\nWAFER: 02\nRowData: 001\n"
+	if got := string(MarshalWaferMap(m)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWaferMapRoundTripBytes(t *testing.T) {
+	// 间距不规则、尾部行夹在 RowData 之间、换行符混用、末尾没有换行符
+	content := "DEVICE:  XYZ\r\n" +
+		"LOT:A1\n" +
+		"WAFER:   03\r\n" +
+		"RowData:  001   005 ...\n" +
+		"NOTE: retest\r\n" +
+		"\tRowData: ___ 001 001  \n" +
+		"END"
+	path := writeTempMap(t, "in.txt", content)
+	m, err := ReadWaferMap(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(MarshalWaferMap(m)); got != content {
+		t.Errorf("unedited map\ngot:  %q\nwant: %q", got, content)
+	}
+
+	// 只重新生成被修改的行，其余行保持原样
+	m.Rows[1][0] = "099"
+	m.Wafer = "04"
+	want := "DEVICE:  XYZ\r\n" +
+		"LOT:A1\n" +
+		"WAFER: 04\r\n" +
+		"RowData:  001   005 ...\n" +
+		"NOTE: retest\r\n" +
+		"RowData: 099 001 001\n" +
+		"END"
+	if got := string(MarshalWaferMap(m)); got != want {
+		t.Errorf("edited map\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestWaferMapCorpusBytes(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(corpusDir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			original, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			maps, err := ReadWaferMaps(file, Options{})
+			if errors.Is(err, model.ErrNoData) {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(maps) > 1 {
+				// 多晶圆文件各块的原始行依次相接应与原文件一致，逐块写出时按各自的原始行输出
+				var joined []byte
+				for _, m := range maps {
+					joined = append(joined, strings.Join(m.Lines, "")...)
+				}
+				if string(joined) != string(original) {
+					t.Errorf("blocks do not cover the file\ngot:  %q\nwant: %q", joined, original)
+				}
+				return
+			}
+			out := filepath.Join(t.TempDir(), "out.txt")
+			if err := WriteWaferMap(out, maps[0]); err != nil {
+				t.Fatal(err)
+			}
+			written, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(written, original) {
+				t.Errorf("written content differs\ngot:  %q\nwant: %q", written, original)
+			}
+		})
+	}
+}
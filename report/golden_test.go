@@ -0,0 +1,199 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/analysis"
+	"deviceParser/mapping"
+	"deviceParser/model"
+	"deviceParser/parser"
+)
+
+// update 为 true 时用当前输出覆盖 golden 文件：go test ./report -update
+var update = flag.Bool("update", false, "用当前输出覆盖 golden 文件")
+
+// corpusDir 解析与报表测试共用的 map 文件样本
+const corpusDir = "../testdata/maps"
+
+// goldenNames 报表测试使用的名称映射，001 有自定义名称，其余编号使用前缀
+var goldenNames = model.BinNames{Names: map[string]string{"001": "PASS", "005": "OPEN"}, Prefix: "BIN"}
+
+// extractCorpus 按界面处理流程提取全部样本：失效簇分析、SBL 检查，并保留每个文件的处理记录
+func extractCorpus(t *testing.T) ([]model.FileResult, []model.FileOutcome) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(corpusDir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []model.FileResult
+	var outcomes []model.FileOutcome
+	for _, file := range files {
+		filePath := path.Join(corpusDir, filepath.Base(file))
+		fileResults, outcome, err := parser.Extract(filePath, parser.Options{})
+		outcomes = append(outcomes, outcome)
+		if err != nil {
+			continue
+		}
+		maps, err := parser.ReadWaferMaps(filePath, parser.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, result := range fileResults {
+			summary := analysis.AnalyzeClusters(maps[i], analysis.ClusterOptions{Connectivity: 8, MaxClusterSize: 2})
+			result.Clusters = &summary
+			results = append(results, result)
+		}
+	}
+	maxCount, maxPercent := 2, 10.0
+	limits := mapping.Limits{Bins: map[string]mapping.BinLimit{"012": {MaxCount: &maxCount}, "005": {MaxPercent: &maxPercent}}, MinYield: 75}
+	mapping.ApplyLimits(results, limits, nil)
+	return results, outcomes
+}
+
+func TestGoldenSummary(t *testing.T) {
+	results, outcomes := extractCorpus(t)
+	dir := t.TempDir()
+
+	summaryPath := filepath.Join(dir, "summary.xlsx")
+	if err := WriteSummary(summaryPath, "处理结果", results, goldenNames, outcomes); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, filepath.Join("testdata", "summary.golden"), dumpWorkbook(t, summaryPath))
+
+	// 独立文件模式：每片晶圆按两种版式各生成一个工作簿，不含 Log 工作表
+	for _, result := range results {
+		name := FileNameStem(result.FileName, result.Block)
+		t.Run(name, func(t *testing.T) {
+			for _, item := range LayoutLabels {
+				goldenName := name
+				if item.Layout != LayoutTable {
+					goldenName += "_" + string(item.Layout)
+				}
+				outPath := filepath.Join(dir, goldenName+"_result.xlsx")
+				if err := WriteWafer(outPath, result, goldenNames, item.Layout); err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, filepath.Join("testdata", goldenName+".golden"), dumpWorkbook(t, outPath))
+			}
+		})
+	}
+
+	if err := WriteSummary(filepath.Join(dir, "empty.xlsx"), "处理结果", nil, goldenNames, outcomes); !errors.Is(err, model.ErrNoData) {
+		t.Errorf("empty results: err = %v, want ErrNoData", err)
+	}
+	if err := WriteWafer(filepath.Join(dir, "empty.xlsx"), model.FileResult{}, goldenNames, LayoutHorizontal); !errors.Is(err, model.ErrNoData) {
+		t.Errorf("empty wafer: err = %v, want ErrNoData", err)
+	}
+}
+
+// dumpWorkbook 将工作簿转换为便于审阅的文本：每个工作表的合并区域、列宽以及每个非空单元格的值和主要样式
+func dumpWorkbook(t *testing.T, filePath string) []byte {
+	t.Helper()
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	for _, sheet := range f.GetSheetList() {
+		fmt.Fprintf(&buf, "== %s\n", sheet)
+		merged, err := f.GetMergeCells(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range merged {
+			fmt.Fprintf(&buf, "merge %s:%s\n", m.GetStartAxis(), m.GetEndAxis())
+		}
+		cols, err := f.GetCols(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range cols {
+			colName, _ := excelize.ColumnNumberToName(i + 1)
+			width, err := f.GetColWidth(sheet, colName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(&buf, "width %s %.1f\n", colName, width)
+		}
+
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r, row := range rows {
+			for c, value := range row {
+				if value == "" {
+					continue
+				}
+				cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				fmt.Fprintf(&buf, "%s %q%s\n", cell, value, cellStyle(t, f, sheet, cell))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// cellStyle 返回单元格中影响审阅的样式：加粗、字体颜色、填充色及水平对齐
+func cellStyle(t *testing.T, f *excelize.File, sheet, cell string) string {
+	t.Helper()
+	id, err := f.GetCellStyle(sheet, cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := f.GetStyle(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs []string
+	if style.Font != nil {
+		if style.Font.Bold {
+			attrs = append(attrs, "bold")
+		}
+		if style.Font.Color != "" {
+			attrs = append(attrs, "color="+style.Font.Color)
+		}
+	}
+	if len(style.Fill.Color) > 0 {
+		attrs = append(attrs, "fill="+strings.Join(style.Fill.Color, ","))
+	}
+	if style.Alignment != nil && style.Alignment.Horizontal != "" {
+		attrs = append(attrs, "align="+style.Alignment.Horizontal)
+	}
+	if len(attrs) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(attrs, " ") + "]"
+}
+
+// checkGolden 将输出与 golden 文件比较，-update 时改为写入 golden 文件
+func checkGolden(t *testing.T, goldenPath string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("读取 golden 文件失败 (可使用 -update 生成): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("输出与 %s 不一致 (确认改动无误后使用 -update 更新):\n--- got\n%s\n--- want\n%s", goldenPath, got, want)
+	}
+}
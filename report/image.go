@@ -0,0 +1,77 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"deviceParser/model"
+)
+
+// MaxImagePixels 晶圆图 PNG 的像素总数上限 (约 64 MB 内存)，超过时返回 ErrImageTooLarge
+const MaxImagePixels = 16 << 20
+
+// ErrImageTooLarge 晶圆图按给定的 cellSize 绘制后超过 MaxImagePixels
+var ErrImageTooLarge = errors.New("晶圆图过大")
+
+var (
+	goodDieColor    = color.RGBA{0x4C, 0xAF, 0x50, 0xFF}
+	skippedDieColor = color.RGBA{0xD0, 0xD0, 0xD0, 0xFF}
+	// failDiePalette 失效 bin 的配色，按 bin 编号哈希选取，同一编号在不同图中颜色一致
+	failDiePalette = []color.RGBA{
+		{0xE5, 0x39, 0x35, 0xFF}, {0xFB, 0x8C, 0x00, 0xFF}, {0xFD, 0xD8, 0x35, 0xFF},
+		{0x8E, 0x24, 0xAA, 0xFF}, {0x1E, 0x88, 0xE5, 0xFF}, {0x6D, 0x4C, 0x41, 0xFF},
+		{0xD8, 0x1B, 0x60, 0xFF}, {0x00, 0x89, 0x7B, 0xFF}, {0x54, 0x6E, 0x7A, 0xFF},
+		{0x3F, 0x51, 0xB5, 0xFF}, {0xC0, 0xCA, 0x33, 0xFF}, {0xF4, 0x51, 0x1E, 0xFF},
+	}
+)
+
+// dieColor 返回单个 die 的颜色，没有 die 的位置返回透明
+func dieColor(token string, goodBins []string) color.RGBA {
+	switch {
+	case token == model.EmptyDie:
+		return color.RGBA{}
+	case token == model.SkippedDie:
+		return skippedDieColor
+	case model.IsGoodBin(token, goodBins):
+		return goodDieColor
+	}
+	h := fnv.New32a()
+	h.Write([]byte(token))
+	return failDiePalette[h.Sum32()%uint32(len(failDiePalette))]
+}
+
+// RenderWaferMapPNG 将晶圆图绘制为 PNG，每个 die 占 cellSize 像素 (含 1 像素间隔)；
+// 像素总数超过 MaxImagePixels 时在分配图像前返回 ErrImageTooLarge
+func RenderWaferMapPNG(w io.Writer, m model.WaferMap, goodBins []string, cellSize int) error {
+	cols := 0
+	for _, row := range m.Rows {
+		cols = max(cols, len(row))
+	}
+	if cols == 0 || cellSize < 2 {
+		return model.ErrNoData
+	}
+	if pixels := int64(cols) * int64(len(m.Rows)) * int64(cellSize) * int64(cellSize); pixels > MaxImagePixels {
+		return fmt.Errorf("%w: %d×%d 个 die，每个 %d 像素，共 %d 像素，上限 %d", ErrImageTooLarge, cols, len(m.Rows), cellSize, pixels, MaxImagePixels)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, cols*cellSize, len(m.Rows)*cellSize))
+	for y, row := range m.Rows {
+		for x, token := range row {
+			c := dieColor(token, goodBins)
+			for py := y * cellSize; py < (y+1)*cellSize-1; py++ {
+				for px := x * cellSize; px < (x+1)*cellSize-1; px++ {
+					img.SetRGBA(px, py, c)
+				}
+			}
+		}
+	}
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("生成图片失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/analysis"
+	"deviceParser/model"
+)
+
+// WriteInk 将每个晶圆各规则的打墨数量写入 Excel
+func WriteInk(outputFilePath string, results []analysis.InkResult) error {
+	if len(results) == 0 {
+		return model.ErrNoData
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheetName := "Sheet1"
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	centeredStyle, _ := f.NewStyle(&excelize.Style{Alignment: &excelize.Alignment{Horizontal: "center"}})
+
+	headers := []string{"扩散批号", "文件名", "邻近失效", "边缘", "失效簇", "合计"}
+	for i, h := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheetName, cell, h)
+		f.SetCellStyle(sheetName, cell, cell, headerStyle)
+	}
+
+	colWidths := make([]float64, len(headers))
+	for i, h := range headers {
+		colWidths[i] = calculateApproxTextWidth(h)
+	}
+	for i, r := range results {
+		rowNum := i + 2
+		id := fmt.Sprintf("%s-%s", r.Map.Lot, r.Map.Wafer)
+		values := []interface{}{id, r.Map.FileName, r.Neighbor, r.Edge, r.Cluster, r.Total()}
+		for j, v := range values {
+			cell, _ := excelize.CoordinatesToCellName(j+1, rowNum)
+			f.SetCellValue(sheetName, cell, v)
+			f.SetCellStyle(sheetName, cell, cell, centeredStyle)
+			if w := calculateApproxTextWidth(fmt.Sprint(v)); w > colWidths[j] {
+				colWidths[j] = w
+			}
+		}
+	}
+	for i, w := range colWidths {
+		colName, _ := excelize.ColumnNumberToName(i + 1)
+		f.SetColWidth(sheetName, colName, colName, w)
+	}
+
+	now := nowISO8601()
+	_ = f.SetDocProps(&excelize.DocProperties{Created: now, Modified: now, Creator: "deviceParser"})
+
+	return saveWorkbook(f, outputFilePath)
+}
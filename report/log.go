@@ -0,0 +1,74 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+// writeLogSheet 新建 "Log" 工作表，逐个列出本次批处理中每个文件的处理结果，失败的行标红
+// 存在校验问题时另外追加 "Diagnostics" 工作表
+func writeLogSheet(f *excelize.File, outcomes []model.FileOutcome, styles summaryStyles) error {
+	headers := []string{"文件名", "状态", "扩散批号", "说明", "路径"}
+	widths := headerWidths(headers)
+
+	rows := make([][]interface{}, 0, len(outcomes))
+	rowStyles := make([]int, 0, len(outcomes))
+	for _, o := range outcomes {
+		id := ""
+		if o.Lot != "" || o.Wafer != "" {
+			id = fmt.Sprintf("%s-%s", o.Lot, o.Wafer)
+		}
+		style := styles.left
+		if o.Failed() {
+			style = styles.leftFlagged
+		}
+		values := []interface{}{o.Name, string(o.Status), id, o.Detail, o.Path}
+		for j, v := range values {
+			widths[j] = max(widths[j], calculateApproxTextWidth(v.(string)))
+		}
+		rows = append(rows, values)
+		rowStyles = append(rowStyles, style)
+	}
+	if err := writeTable(f, "Log", headers, widths, rows, rowStyles, styles.header); err != nil {
+		return err
+	}
+	return writeDiagnosticSheet(f, outcomes, styles)
+}
+
+// writeDiagnosticSheet 存在校验问题时新建 "Diagnostics" 工作表，逐条列出文件、行号、列号及说明
+func writeDiagnosticSheet(f *excelize.File, outcomes []model.FileOutcome, styles summaryStyles) error {
+	var diags []model.Diagnostic
+	for _, o := range outcomes {
+		diags = append(diags, o.Diagnostics...)
+	}
+	if len(diags) == 0 {
+		return nil
+	}
+
+	headers := []string{"文件名", "行", "列", "严重程度", "说明"}
+	widths := headerWidths(headers)
+	rows := make([][]interface{}, 0, len(diags))
+	rowStyles := make([]int, 0, len(diags))
+	for _, d := range diags {
+		values := []interface{}{d.File, "", "", string(d.Severity), d.Message}
+		if d.Line > 0 {
+			values[1] = d.Line
+		}
+		if d.Column > 0 {
+			values[2] = d.Column
+		}
+		for j, v := range values {
+			widths[j] = max(widths[j], calculateApproxTextWidth(fmt.Sprint(v)))
+		}
+		style := 0
+		if d.Severity == model.SeverityError {
+			style = styles.errorText
+		}
+		rows = append(rows, values)
+		rowStyles = append(rowStyles, style)
+	}
+	return writeTable(f, "Diagnostics", headers, widths, rows, rowStyles, styles.header)
+}
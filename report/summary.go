@@ -0,0 +1,333 @@
+// Package report 生成 Excel 报表 (汇总表、趋势报告、打墨报告) 及晶圆图图片
+package report
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+// summaryStyles 汇总工作簿中用到的全部样式，写入前一次性创建，各工作表共用
+type summaryStyles struct {
+	title       int
+	header      int
+	centered    int
+	flagged     int // 超过阈值的单元格：红字红底
+	left        int
+	leftFlagged int // Log 工作表中处理失败的行
+	errorText   int // Diagnostics 工作表中错误级别的问题
+}
+
+// newSummaryStyles 创建汇总工作簿的样式
+func newSummaryStyles(f *excelize.File) (summaryStyles, error) {
+	var styles summaryStyles
+	for _, item := range []struct {
+		id    *int
+		style *excelize.Style
+	}{
+		{&styles.title, &excelize.Style{
+			Font:      &excelize.Font{Bold: true, Size: 14}, // 标题字体可以大一些
+			Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		}},
+		{&styles.header, &excelize.Style{
+			Font:      &excelize.Font{Bold: true},
+			Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		}},
+		{&styles.centered, &excelize.Style{Alignment: &excelize.Alignment{Horizontal: "center"}}},
+		{&styles.flagged, &excelize.Style{
+			Alignment: &excelize.Alignment{Horizontal: "center"},
+			Font:      &excelize.Font{Bold: true, Color: "9C0006"},
+			Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFC7CE"}},
+		}},
+		{&styles.left, &excelize.Style{Alignment: &excelize.Alignment{Horizontal: "left"}}},
+		{&styles.leftFlagged, &excelize.Style{
+			Alignment: &excelize.Alignment{Horizontal: "left"},
+			Font:      &excelize.Font{Color: "9C0006"},
+			Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFC7CE"}},
+		}},
+		{&styles.errorText, &excelize.Style{Font: &excelize.Font{Color: "9C0006"}}},
+	} {
+		id, err := f.NewStyle(item.style)
+		if err != nil {
+			return summaryStyles{}, fmt.Errorf("创建样式失败: %w", err)
+		}
+		*item.id = id
+	}
+	return styles, nil
+}
+
+// WriteSummary 负责将处理好的数据写入Excel文件，outcomes 不为空时追加 Log 工作表列出每个文件的处理结果
+// 各工作表按行流式写入，数千片晶圆、数百个 bin 时也不必在内存中保留每个单元格
+func WriteSummary(outputFilePath string, title string, results []model.FileResult, names model.BinNames, outcomes []model.FileOutcome) error {
+	if len(results) == 0 {
+		return model.ErrNoData
+	}
+
+	// 1. 汇总所有文件中出现过的、独一无二的key，并进行排序
+	allKeysSet := make(map[string]struct{})
+	for _, result := range results {
+		for key := range result.Counts {
+			allKeysSet[key] = struct{}{}
+		}
+	}
+	var sortedAllKeys []string
+	for k := range allKeysSet {
+		sortedAllKeys = append(sortedAllKeys, k)
+	}
+	sort.Strings(sortedAllKeys)
+
+	// 如果所有文件中都没有数据，也返回错误
+	if len(sortedAllKeys) == 0 {
+		return model.ErrNoData
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	styles, err := newSummaryStyles(f)
+	if err != nil {
+		return err
+	}
+
+	// 任一文件做过失效簇分析时，在 bin 列之后追加簇统计列
+	withClusters := false
+	for _, result := range results {
+		if result.Clusters != nil {
+			withClusters = true
+			break
+		}
+	}
+	if err := writeSummarySheet(f, "Sheet1", title, results, sortedAllKeys, withClusters, names, styles); err != nil {
+		return err
+	}
+
+	if withClusters {
+		if err := writeClusterSheet(f, results, styles); err != nil {
+			return err
+		}
+	}
+	for _, result := range results {
+		if len(result.Alarms) > 0 {
+			if err := writeAlarmSheet(f, results, names, styles); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if len(outcomes) > 0 {
+		if err := writeLogSheet(f, outcomes, styles); err != nil {
+			return err
+		}
+	}
+
+	// 设置文档属性并保存
+	now := nowISO8601()
+	_ = f.SetDocProps(&excelize.DocProperties{Created: now, Modified: now, Creator: "deviceParser"})
+	return saveWorkbook(f, outputFilePath)
+}
+
+// writeSummarySheet 写入汇总主表：第 1 行为跨列标题，第 2 行为表头，此后每片晶圆一行
+func writeSummarySheet(f *excelize.File, sheetName, title string, results []model.FileResult, sortedAllKeys []string, withClusters bool, names model.BinNames, styles summaryStyles) error {
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+
+	// 表头：扩散批号、每个 key 的 "名称 (编号)"，以及簇统计列
+	headers := []string{"扩散批号"}
+	for _, key := range sortedAllKeys {
+		headers = append(headers, fmt.Sprintf("%s (%s)", names.Name(key), key))
+	}
+	if withClusters {
+		headers = append(headers, "失效簇数", "最大簇")
+	}
+	numDataCols := len(headers)
+
+	// 流式写入要求在写行之前设置列宽：表头宽度，扩散批号列再按文件名加宽 (不超过 maxColWidth)
+	for i, headerText := range headers {
+		width := calculateApproxTextWidth(headerText)
+		if i == 0 {
+			for _, result := range results {
+				width = max(width, calculateApproxTextWidth(result.FileName))
+			}
+		}
+		if err := sw.SetColWidth(i+1, i+1, min(width, maxColWidth)); err != nil {
+			return fmt.Errorf("设置列宽失败: %w", err)
+		}
+	}
+
+	// 第 1 行：合并所有数据列的主标题
+	endCellCol, _ := excelize.ColumnNumberToName(numDataCols)
+	if err := sw.MergeCell("A1", fmt.Sprintf("%s1", endCellCol)); err != nil {
+		return fmt.Errorf("合并单元格失败: %w", err)
+	}
+	row := make([]interface{}, numDataCols)
+	row[0] = excelize.Cell{StyleID: styles.title, Value: title}
+	for i := 1; i < numDataCols; i++ {
+		row[i] = excelize.Cell{StyleID: styles.title}
+	}
+	if err := sw.SetRow("A1", row); err != nil {
+		return fmt.Errorf("写入标题失败: %w", err)
+	}
+
+	// 第 2 行：表头
+	for i, headerText := range headers {
+		row[i] = excelize.Cell{StyleID: styles.header, Value: headerText}
+	}
+	if err := sw.SetRow("A2", row); err != nil {
+		return fmt.Errorf("写入表头失败: %w", err)
+	}
+
+	// 逐行写入每个文件的数据，行切片复用
+	clusterCountCol := len(sortedAllKeys) + 1
+	for i, result := range results {
+		clear(row)
+		// 超限的 bin 及良率，对应单元格标红
+		alarmBins := make(map[string]bool)
+		for _, a := range result.Alarms {
+			alarmBins[a.Bin] = true
+		}
+
+		// 扩散批号，良率超限时标红
+		id := excelize.Cell{Value: waferID(result)}
+		if alarmBins[""] {
+			id.StyleID = styles.flagged
+		}
+		row[0] = id
+
+		// 每个 key 对应的计数值，当前文件没有这个 key 时填 0
+		for j, key := range sortedAllKeys {
+			style := styles.centered
+			if alarmBins[key] {
+				style = styles.flagged
+			}
+			row[j+1] = excelize.Cell{StyleID: style, Value: result.Counts[key]}
+		}
+
+		// 失效簇统计
+		if result.Clusters != nil {
+			style := styles.centered
+			if result.Clusters.Flagged {
+				style = styles.flagged
+			}
+			row[clusterCountCol] = excelize.Cell{StyleID: style, Value: result.Clusters.Count}
+			row[clusterCountCol+1] = excelize.Cell{StyleID: style, Value: result.Clusters.Largest}
+		}
+
+		cell, _ := excelize.CoordinatesToCellName(1, i+3) // 从第3行开始
+		if err := sw.SetRow(cell, row); err != nil {
+			return fmt.Errorf("写入数据失败: %w", err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("写入工作表失败: %w", err)
+	}
+	return nil
+}
+
+// maxColWidth 按内容估算的列宽上限，避免超长文件名或说明撑出过宽的列 (Excel 列宽不能超过 255)
+const maxColWidth = 80
+
+// writeTable 以流式写入 "表头 + 数据行" 形式的工作表，rows 中每行的单元格使用同一样式，列宽不超过 maxColWidth
+func writeTable(f *excelize.File, sheetName string, headers []string, widths []float64, rows [][]interface{}, rowStyles []int, headerStyle int) error {
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+	for i, w := range widths {
+		if err := sw.SetColWidth(i+1, i+1, min(w, maxColWidth)); err != nil {
+			return fmt.Errorf("设置列宽失败: %w", err)
+		}
+	}
+
+	row := make([]interface{}, len(headers))
+	for i, h := range headers {
+		row[i] = excelize.Cell{StyleID: headerStyle, Value: h}
+	}
+	if err := sw.SetRow("A1", row); err != nil {
+		return fmt.Errorf("写入表头失败: %w", err)
+	}
+	for i, values := range rows {
+		for j, v := range values {
+			row[j] = excelize.Cell{StyleID: rowStyles[i], Value: v}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := sw.SetRow(cell, row[:len(values)]); err != nil {
+			return fmt.Errorf("写入数据失败: %w", err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("写入工作表失败: %w", err)
+	}
+	return nil
+}
+
+// headerWidths 返回按表头估算的列宽，作为各列宽度的初始值
+func headerWidths(headers []string) []float64 {
+	widths := make([]float64, len(headers))
+	for i, h := range headers {
+		widths[i] = calculateApproxTextWidth(h)
+	}
+	return widths
+}
+
+// writeClusterSheet 新建 "失效簇" 工作表，逐个列出每个晶圆的失效簇及其外接矩形 (行列从 1 开始)
+func writeClusterSheet(f *excelize.File, results []model.FileResult, styles summaryStyles) error {
+	headers := []string{"扩散批号", "序号", "大小", "起始行", "起始列", "结束行", "结束列", "超出阈值"}
+	widths := headerWidths(headers)
+
+	var rows [][]interface{}
+	for _, result := range results {
+		if result.Clusters == nil {
+			continue
+		}
+		id := waferID(result)
+		widths[0] = max(widths[0], calculateApproxTextWidth(id))
+		flagged := ""
+		if result.Clusters.Flagged {
+			flagged = "是"
+		}
+		for i, box := range result.Clusters.Boxes {
+			rows = append(rows, []interface{}{id, i + 1, box.Size, box.MinRow + 1, box.MinCol + 1, box.MaxRow + 1, box.MaxCol + 1, flagged})
+		}
+	}
+	return writeTable(f, "失效簇", headers, widths, rows, uniformStyles(len(rows), styles.centered), styles.header)
+}
+
+// writeAlarmSheet 新建 "Alarms" 工作表，列出所有超出 SBL 限值的晶圆及 bin
+func writeAlarmSheet(f *excelize.File, results []model.FileResult, names model.BinNames, styles summaryStyles) error {
+	headers := []string{"扩散批号", "文件名", "Bin", "类型", "实际值", "限值", "说明"}
+	widths := headerWidths(headers)
+
+	var rows [][]interface{}
+	for _, result := range results {
+		id := waferID(result)
+		for _, a := range result.Alarms {
+			binText := ""
+			if a.Bin != "" {
+				binText = fmt.Sprintf("%s (%s)", names.Name(a.Bin), a.Bin)
+			}
+			values := []interface{}{id, result.FileName, binText, a.Kind, math.Round(a.Value*100) / 100, a.Limit, a.String()}
+			for j, v := range values {
+				widths[j] = max(widths[j], calculateApproxTextWidth(fmt.Sprint(v)))
+			}
+			rows = append(rows, values)
+		}
+	}
+	return writeTable(f, "Alarms", headers, widths, rows, uniformStyles(len(rows), styles.centered), styles.header)
+}
+
+// uniformStyles 返回 n 行相同的行样式
+func uniformStyles(n, style int) []int {
+	rowStyles := make([]int, n)
+	for i := range rowStyles {
+		rowStyles[i] = style
+	}
+	return rowStyles
+}
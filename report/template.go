@@ -0,0 +1,337 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+// RepeatMarker 模板中标记重复行的占位符：所在行按晶圆逐片复制，每片一行
+const RepeatMarker = "{{#wafers}}"
+
+// placeholderPattern 匹配 {{...}} 形式的占位符
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// TemplateHelp 模板中可用的占位符说明，界面及命令行帮助中显示
+const TemplateHelp = `{{title}}            报表标题
+{{date}}             生成日期
+{{count}}            晶圆片数
+{{lot}} {{wafer}}    批号、片号 (重复行外为全部晶圆去重后以逗号连接)
+{{id}}               批号-片号 (全部保留的重复晶圆加 #2、#3 后缀)
+{{file}}             源文件名
+{{total}}            die 总数
+{{yield}}            良率 (百分比)
+{{meta:DEVICE}}      头部信息，如 DEVICE、TEST DATE
+{{bin:001.count}}    bin 001 的数量 (重复行外为全部晶圆之和)
+{{bin:001.percent}}  bin 001 占 die 总数的百分比
+{{bin:001.name}}     bin 001 的显示名称
+{{index}}            重复行中的序号 (从 1 开始)
+{{#wafers}}          放在任一单元格中，所在行按晶圆逐片复制；
+                     合计公式的区域从表头行开始到该行为止 (如 SUM(C3:C4))，展开后区域自动覆盖全部晶圆；
+                     图片需放在该行之上`
+
+// templateScope 填充占位符时的数据：重复行中为单片晶圆，重复行外为全部晶圆的合计
+type templateScope struct {
+	result model.FileResult
+	index  int // 重复行中的序号，重复行外为 0
+}
+
+// templateContext 一次模板填充共用的数据
+type templateContext struct {
+	title    string
+	count    int
+	names    model.BinNames
+	goodBins []string
+	now      time.Time
+}
+
+// WriteTemplate 用结果填充用户提供的 xlsx 模板并另存为 outputFilePath
+// 模板中的字体、图片、公式及其他未含占位符的内容保持不变；含公式的单元格不做替换
+func WriteTemplate(templatePath, outputFilePath, title string, results []model.FileResult, names model.BinNames, goodBins []string) error {
+	if len(results) == 0 {
+		return model.ErrNoData
+	}
+
+	f, err := excelize.OpenFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("打开报表模板失败: %w", err)
+	}
+	defer f.Close()
+
+	ctx := templateContext{title: title, count: len(results), names: names, goodBins: goodBins, now: time.Now()}
+	total := templateScope{result: combineResults(results)}
+	for _, sheet := range f.GetSheetList() {
+		if err := fillSheet(f, sheet, ctx, total, results); err != nil {
+			return fmt.Errorf("工作表 %s: %w", sheet, err)
+		}
+	}
+
+	return saveWorkbook(f, outputFilePath)
+}
+
+// templateCell 模板中含占位符的单元格，col 从 1 开始
+type templateCell struct {
+	col  int
+	text string
+}
+
+// fillSheet 先替换重复行以外的占位符，再自下而上展开重复行，避免插入的行改变尚未处理的行号
+func fillSheet(f *excelize.File, sheet string, ctx templateContext, total templateScope, results []model.FileResult) error {
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return fmt.Errorf("读取工作表失败: %w", err)
+	}
+
+	repeatRows := make(map[int][]templateCell) // 行号 (从 1 开始) -> 含占位符的单元格
+	var repeatOrder []int
+	for r, row := range rows {
+		rowNum := r + 1
+		var cells []templateCell
+		repeat := false
+		for c, text := range row {
+			if !strings.Contains(text, "{{") {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(c+1, rowNum)
+			if formula, _ := f.GetCellFormula(sheet, cell); formula != "" {
+				continue
+			}
+			cells = append(cells, templateCell{col: c + 1, text: text})
+			repeat = repeat || strings.Contains(text, RepeatMarker)
+		}
+		if repeat {
+			repeatRows[rowNum] = cells
+			repeatOrder = append(repeatOrder, rowNum)
+			continue
+		}
+		for _, cell := range cells {
+			if err := fillCell(f, sheet, cell, rowNum, ctx, total); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(repeatOrder) > 0 && len(results) > 1 {
+		if err := checkPictures(f, sheet, repeatOrder[0]); err != nil {
+			return err
+		}
+	}
+
+	slices.Reverse(repeatOrder)
+	for _, rowNum := range repeatOrder {
+		if err := expandRow(f, sheet, rowNum, len(results)); err != nil {
+			return fmt.Errorf("复制重复行失败: %w", err)
+		}
+		for i, result := range results {
+			for _, cell := range repeatRows[rowNum] {
+				if err := fillCell(f, sheet, cell, rowNum+i, ctx, templateScope{result: result, index: i + 1}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// expandRow 将第 row 行复制为 n 行。副本插在模板行之上，
+// 这样止于模板行的公式区域 (如表头行到模板行的 SUM(C3:C4)) 会随插入的行扩大，与在 Excel 中插入行的效果一致
+func expandRow(f *excelize.File, sheet string, row, n int) error {
+	if n <= 1 {
+		return nil
+	}
+	if err := f.InsertRows(sheet, row, n-1); err != nil {
+		return err
+	}
+	template := row + n - 1
+	for i := range n - 1 {
+		// DuplicateRowTo 会在目标位置再插入一行，复制后删除被挤到下一行的空行
+		if err := f.DuplicateRowTo(sheet, template, row+i); err != nil {
+			return err
+		}
+		if err := f.RemoveRow(sheet, row+i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPictures 检查是否有图片锚定在第一个重复行或其下方。excelize 插入行时只移动图片的起始锚点，
+// 两端锚定的图片会被拉伸变形，因此要求图片放在重复行之上
+func checkPictures(f *excelize.File, sheet string, repeatRow int) error {
+	cells, err := f.GetPictureCells(sheet)
+	if err != nil {
+		return fmt.Errorf("读取图片失败: %w", err)
+	}
+	for _, cell := range cells {
+		if _, row, err := excelize.CellNameToCoordinates(cell); err == nil && row >= repeatRow {
+			return fmt.Errorf("%s 处的图片位于 %s 所在的第 %d 行或其下方，展开重复行时无法随之移动，请将图片移到该行之上", cell, RepeatMarker, repeatRow)
+		}
+	}
+	return nil
+}
+
+// fillCell 替换单元格中的占位符；单元格只含一个占位符且值为数字时写入数字，以便沿用模板的数字格式
+func fillCell(f *excelize.File, sheet string, cell templateCell, rowNum int, ctx templateContext, scope templateScope) error {
+	name, _ := excelize.CoordinatesToCellName(cell.col, rowNum)
+	text := strings.ReplaceAll(cell.text, RepeatMarker, "")
+
+	if m := placeholderPattern.FindStringSubmatch(text); m != nil && m[0] == text {
+		value, err := ctx.resolve(m[1], scope)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return f.SetCellValue(sheet, name, value)
+	}
+
+	var resolveErr error
+	filled := placeholderPattern.ReplaceAllStringFunc(text, func(s string) string {
+		value, err := ctx.resolve(placeholderPattern.FindStringSubmatch(s)[1], scope)
+		if err != nil && resolveErr == nil {
+			resolveErr = fmt.Errorf("%s: %w", name, err)
+		}
+		return fmt.Sprint(value)
+	})
+	if resolveErr != nil {
+		return resolveErr
+	}
+	return f.SetCellStr(sheet, name, filled)
+}
+
+// resolve 返回占位符的值，数量为 int，百分比为保留两位小数的 float64，其余为字符串
+func (ctx templateContext) resolve(key string, scope templateScope) (interface{}, error) {
+	result := scope.result
+	if code, field, ok := strings.Cut(strings.TrimPrefix(key, "bin:"), "."); ok && strings.HasPrefix(key, "bin:") {
+		switch field {
+		case "count":
+			return result.Counts[code], nil
+		case "percent":
+			total := result.TotalDies()
+			if total == 0 {
+				return 0.0, nil
+			}
+			return roundPercent(float64(result.Counts[code]) * 100 / float64(total)), nil
+		case "name":
+			return ctx.names.Name(code), nil
+		}
+		return nil, fmt.Errorf("未知的模板占位符: {{%s}}", key)
+	}
+	if name, ok := strings.CutPrefix(key, "meta:"); ok {
+		return result.Metadata[name], nil
+	}
+
+	switch key {
+	case "title":
+		return ctx.title, nil
+	case "date":
+		return ctx.now.Format("2006-01-02"), nil
+	case "count":
+		return ctx.count, nil
+	case "lot":
+		return result.Lot, nil
+	case "wafer":
+		return result.Wafer, nil
+	case "id":
+		return waferID(result), nil
+	case "file":
+		return result.FileName, nil
+	case "total":
+		return result.TotalDies(), nil
+	case "yield":
+		return roundPercent(result.Yield(ctx.goodBins)), nil
+	case "index":
+		if scope.index == 0 {
+			return nil, fmt.Errorf("{{index}} 只能用于 %s 所在的重复行", RepeatMarker)
+		}
+		return scope.index, nil
+	}
+	return nil, fmt.Errorf("未知的模板占位符: {{%s}}", key)
+}
+
+// roundPercent 百分比保留两位小数
+func roundPercent(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// combineResults 合并全部晶圆供重复行以外的占位符使用：计数相加，批号、片号等文本去重后以逗号连接
+func combineResults(results []model.FileResult) model.FileResult {
+	if len(results) == 1 {
+		return results[0]
+	}
+	combined := model.FileResult{Counts: make(map[string]int), Metadata: make(map[string]string)}
+	var lots, wafers, files []string
+	metadata := make(map[string][]string)
+	for _, result := range results {
+		for code, n := range result.Counts {
+			combined.Counts[code] += n
+		}
+		lots = appendDistinct(lots, result.Lot)
+		wafers = appendDistinct(wafers, result.Wafer)
+		files = appendDistinct(files, result.FileName)
+		for k, v := range result.Metadata {
+			metadata[k] = appendDistinct(metadata[k], v)
+		}
+	}
+	combined.Lot = strings.Join(lots, ", ")
+	combined.Wafer = strings.Join(wafers, ", ")
+	combined.FileName = strings.Join(files, ", ")
+	for k, values := range metadata {
+		combined.Metadata[k] = strings.Join(values, ", ")
+	}
+	return combined
+}
+
+// appendDistinct 追加非空且尚未出现的值
+func appendDistinct(values []string, v string) []string {
+	if v == "" || slices.Contains(values, v) {
+		return values
+	}
+	return append(values, v)
+}
+
+// CheckTemplate 检查模板能否打开、占位符是否都能识别、图片是否都在重复行之上，供选择模板时提前提示错误
+func CheckTemplate(templatePath string) error {
+	f, err := excelize.OpenFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("打开报表模板失败: %w", err)
+	}
+	defer f.Close()
+
+	var ctx templateContext
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return fmt.Errorf("工作表 %s: 读取工作表失败: %w", sheet, err)
+		}
+		repeatRow := 0
+		for r, row := range rows {
+			scope := templateScope{}
+			if slices.ContainsFunc(row, func(text string) bool { return strings.Contains(text, RepeatMarker) }) {
+				scope.index = 1
+				if repeatRow == 0 {
+					repeatRow = r + 1
+				}
+			}
+			for c, text := range row {
+				for _, m := range placeholderPattern.FindAllStringSubmatch(strings.ReplaceAll(text, RepeatMarker, ""), -1) {
+					if _, err := ctx.resolve(m[1], scope); err != nil {
+						cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+						return fmt.Errorf("工作表 %s: %s: %w", sheet, cell, err)
+					}
+				}
+			}
+		}
+		if repeatRow > 0 {
+			if err := checkPictures(f, sheet, repeatRow); err != nil {
+				return fmt.Errorf("工作表 %s: %w", sheet, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package report
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+// writeTestTemplate 生成测试用模板：标题使用自定义字体，第 4 行为重复行，其后为公式和合计行
+func writeTestTemplate(t *testing.T, path string) {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := "Sheet1"
+	titleStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Family: "Arial", Size: 18, Bold: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	numberStyle, err := f.NewStyle(&excelize.Style{NumFmt: 4, Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDEBF7"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cell, value := range map[string]string{
+		"A1": "{{title}}",
+		"A2": "批号: {{lot}}", "B2": "{{count}}",
+		"A3": "序号", "B3": "扩散批号", "C3": "{{bin:001.name}}", "D3": "{{bin:005.name}}",
+		"A4": "{{#wafers}}{{index}}", "B4": "{{id}}", "C4": "{{bin:001.count}}", "D4": "{{bin:005.percent}}",
+		"A5": "合计", "D5": "{{bin:005.count}} 颗 / {{total}}",
+		"A6": "{{meta:DEVICE}}",
+	} {
+		if err := f.SetCellStr(sheet, cell, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.SetCellStyle(sheet, "A1", "A1", titleStyle)
+	f.SetCellFormula(sheet, "C5", "SUM(C3:C4)")
+	f.SetCellStr(sheet, "E4", "{{不在公式中替换}}")
+	f.SetCellFormula(sheet, "E4", `"{{lot}}"`)
+	f.SetCellStyle(sheet, "C4", "D4", numberStyle)
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "template.xlsx")
+	writeTestTemplate(t, templatePath)
+
+	results := []model.FileResult{
+		{Lot: "A12345", Wafer: "01", FileName: "a.txt", Counts: map[string]int{"001": 90, "005": 10}, Metadata: map[string]string{"DEVICE": "DP100"}},
+		{Lot: "A12345", Wafer: "02", FileName: "b.txt", Counts: map[string]int{"001": 45, "005": 5}, Metadata: map[string]string{"DEVICE": "DP100"}},
+		{Lot: "B77", Wafer: "03", FileName: "c.txt", Counts: map[string]int{"001": 50}},
+	}
+	if err := CheckTemplate(templatePath); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(dir, "out.xlsx")
+	if err := WriteTemplate(templatePath, outPath, "月度报告", results, goldenNames, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sheet := "Sheet1"
+	for cell, want := range map[string]string{
+		"A1": "月度报告",
+		"A2": "批号: A12345, B77", "B2": "3",
+		"C3": "PASS", "D3": "OPEN",
+		"A4": "1", "B4": "A12345-01", "C4": "90", "D4": "10",
+		"A5": "2", "B5": "A12345-02", "C5": "45", "D5": "10",
+		"A6": "3", "B6": "B77-03", "C6": "50", "D6": "0",
+		"A7": "合计", "D7": "15 颗 / 200",
+		"A8": "DP100",
+	} {
+		got, err := f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+
+	// 数量写为数字而不是文本
+	if typ, _ := f.GetCellType(sheet, "C4"); typ == excelize.CellTypeSharedString || typ == excelize.CellTypeInlineString {
+		t.Errorf("C4 type = %v, want number", typ)
+	}
+	// 标题字体及公式保持不变，止于重复行的公式区域随插入的行扩大
+	style, err := f.GetStyle(mustCellStyle(t, f, sheet, "A1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style.Font == nil || style.Font.Family != "Arial" || style.Font.Size != 18 || !style.Font.Bold {
+		t.Errorf("title font = %+v", style.Font)
+	}
+	if formula, _ := f.GetCellFormula(sheet, "C7"); formula != "SUM(C3:C6)" {
+		t.Errorf("C7 formula = %q, want SUM(C3:C6)", formula)
+	}
+	// 重复行的样式复制到每一行
+	for _, cell := range []string{"C5", "C6", "D6"} {
+		if got, _ := f.GetCellStyle(sheet, cell); got != mustCellStyle(t, f, sheet, "C4") {
+			t.Errorf("%s style = %d, want the repeat row style", cell, got)
+		}
+	}
+	if formula, _ := f.GetCellFormula(sheet, "E4"); formula != `"{{lot}}"` {
+		t.Errorf("E4 formula = %q", formula)
+	}
+}
+
+func mustCellStyle(t *testing.T, f *excelize.File, sheet, cell string) int {
+	t.Helper()
+	id, err := f.GetCellStyle(sheet, cell)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestCheckTemplate(t *testing.T) {
+	dir := t.TempDir()
+	for name, cells := range map[string]map[string]string{
+		"unknown.xlsx":    {"A1": "{{lots}}"},
+		"bad_field.xlsx":  {"B2": "{{bin:001.yield}}"},
+		"index_out.xlsx":  {"A1": "{{index}}"},
+		"index_in.xlsx":   {"A1": "{{#wafers}}", "B1": "{{index}}"},
+		"plain_text.xlsx": {"A1": "{ {lot} }"},
+	} {
+		f := excelize.NewFile()
+		for cell, value := range cells {
+			f.SetCellStr("Sheet1", cell, value)
+		}
+		path := filepath.Join(dir, name)
+		if err := f.SaveAs(path); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		err := CheckTemplate(path)
+		valid := name == "index_in.xlsx" || name == "plain_text.xlsx"
+		if valid && err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if !valid && (err == nil || !strings.Contains(err.Error(), "Sheet1")) {
+			t.Errorf("%s: err = %v, want error naming the sheet", name, err)
+		}
+		if !valid {
+			if err := WriteTemplate(path, filepath.Join(dir, "out.xlsx"), "", []model.FileResult{{Lot: "A"}}, goldenNames, nil); err == nil {
+				t.Errorf("%s: WriteTemplate succeeded", name)
+			}
+		}
+	}
+
+	if err := CheckTemplate(filepath.Join(dir, "missing.xlsx")); err == nil {
+		t.Error("missing template: expected error")
+	}
+}
+
+func TestTemplatePictures(t *testing.T) {
+	dir := t.TempDir()
+	var logo bytes.Buffer
+	if err := png.Encode(&logo, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	results := []model.FileResult{
+		{Lot: "A1", Wafer: "01", Counts: map[string]int{"001": 1}},
+		{Lot: "A1", Wafer: "02", Counts: map[string]int{"001": 2}},
+		{Lot: "A1", Wafer: "03", Counts: map[string]int{"001": 3}},
+	}
+	for _, tt := range []struct {
+		cell string
+		ok   bool
+	}{
+		{"E1", true},  // 重复行之上，位置不变
+		{"E4", false}, // 重复行
+		{"E6", false}, // 重复行之下
+	} {
+		t.Run(tt.cell, func(t *testing.T) {
+			templatePath := filepath.Join(dir, tt.cell+".xlsx")
+			writeTestTemplate(t, templatePath)
+			f, err := excelize.OpenFile(templatePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Excel 中两端锚定的图片：excelize 插入行时只移动起始锚点
+			pic := &excelize.Picture{Extension: ".png", File: logo.Bytes(), Format: &excelize.GraphicOptions{Positioning: "twoCell"}}
+			if err := f.AddPictureFromBytes("Sheet1", tt.cell, pic); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Save(); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			checkErr := CheckTemplate(templatePath)
+			outPath := filepath.Join(dir, tt.cell+"_out.xlsx")
+			writeErr := WriteTemplate(templatePath, outPath, "", results, goldenNames, nil)
+			if !tt.ok {
+				for _, err := range []error{checkErr, writeErr} {
+					if err == nil || !strings.Contains(err.Error(), "Sheet1") || !strings.Contains(err.Error(), tt.cell) {
+						t.Errorf("err = %v, want error naming the sheet and %s", err, tt.cell)
+					}
+				}
+				// 单片晶圆不展开重复行，图片位置不受影响
+				if err := WriteTemplate(templatePath, outPath, "", results[:1], goldenNames, nil); err != nil {
+					t.Errorf("single wafer: %v", err)
+				}
+				return
+			}
+			if checkErr != nil || writeErr != nil {
+				t.Fatalf("check: %v, write: %v", checkErr, writeErr)
+			}
+			out, err := excelize.OpenFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer out.Close()
+			if cells, err := out.GetPictureCells("Sheet1"); err != nil || len(cells) != 1 || cells[0] != tt.cell {
+				t.Errorf("pictures = %v, %v, want [%s]", cells, err, tt.cell)
+			}
+		})
+	}
+}
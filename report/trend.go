@@ -0,0 +1,110 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/analysis"
+	"deviceParser/model"
+)
+
+// WriteTrend 生成趋势报告：按测试时间排列的各 LOT 良率及主要失效 bin 占比，附折线图
+func WriteTrend(outputFilePath string, lots []analysis.LotTrend, topBins []string, names model.BinNames) error {
+	if len(lots) == 0 {
+		return model.ErrNoData
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheetName := "趋势"
+	if err := f.SetSheetName("Sheet1", sheetName); err != nil {
+		return fmt.Errorf("创建工作表失败: %w", err)
+	}
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	centeredStyle, _ := f.NewStyle(&excelize.Style{Alignment: &excelize.Alignment{Horizontal: "center"}})
+	percentStyle, _ := f.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{Horizontal: "center"},
+		NumFmt:    2, // 0.00
+	})
+
+	headers := []string{"扩散批号", "测试日期", "晶圆数", "die数", "良率(%)"}
+	for _, code := range topBins {
+		headers = append(headers, fmt.Sprintf("%s (%s) %%", names.Name(code), code))
+	}
+	for i, h := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheetName, cell, h)
+		f.SetCellStyle(sheetName, cell, cell, headerStyle)
+		colName, _ := excelize.ColumnNumberToName(i + 1)
+		f.SetColWidth(sheetName, colName, colName, max(calculateApproxTextWidth(h), 12))
+	}
+
+	for i, lot := range lots {
+		rowNum := i + 2
+		values := []interface{}{lot.Lot, lot.Time.Format("2006-01-02 15:04"), lot.Wafers, lot.Dies, lot.Yield()}
+		for _, code := range topBins {
+			values = append(values, lot.Percent(code))
+		}
+		for j, v := range values {
+			cell, _ := excelize.CoordinatesToCellName(j+1, rowNum)
+			f.SetCellValue(sheetName, cell, v)
+			if j >= 4 {
+				f.SetCellStyle(sheetName, cell, cell, percentStyle)
+			} else {
+				f.SetCellStyle(sheetName, cell, cell, centeredStyle)
+			}
+		}
+	}
+
+	// 折线图：良率趋势、主要失效 bin 占比趋势
+	lastRow := len(lots) + 1
+	categories := fmt.Sprintf("'%s'!$A$2:$A$%d", sheetName, lastRow)
+	series := func(col int) excelize.ChartSeries {
+		colName, _ := excelize.ColumnNumberToName(col)
+		return excelize.ChartSeries{
+			Name:       fmt.Sprintf("'%s'!$%s$1", sheetName, colName),
+			Categories: categories,
+			Values:     fmt.Sprintf("'%s'!$%s$2:$%s$%d", sheetName, colName, colName, lastRow),
+			Marker:     excelize.ChartMarker{Symbol: "circle", Size: 5},
+		}
+	}
+	chartCol, _ := excelize.ColumnNumberToName(len(headers) + 2)
+
+	yieldChart := &excelize.Chart{
+		Type:   excelize.Line,
+		Series: []excelize.ChartSeries{series(5)},
+		Title:  []excelize.RichTextRun{{Text: "良率趋势"}},
+		Legend: excelize.ChartLegend{Position: "bottom"},
+		YAxis:  excelize.ChartAxis{MajorGridLines: true, Title: []excelize.RichTextRun{{Text: "良率 (%)"}}},
+		Format: excelize.GraphicOptions{ScaleX: 1.5, ScaleY: 1.2},
+	}
+	if err := f.AddChart(sheetName, chartCol+"2", yieldChart); err != nil {
+		return fmt.Errorf("创建图表失败: %w", err)
+	}
+
+	if len(topBins) > 0 {
+		binChart := &excelize.Chart{
+			Type:   excelize.Line,
+			Title:  []excelize.RichTextRun{{Text: "主要失效 bin 占比趋势"}},
+			Legend: excelize.ChartLegend{Position: "bottom"},
+			YAxis:  excelize.ChartAxis{MajorGridLines: true, Title: []excelize.RichTextRun{{Text: "占比 (%)"}}},
+			Format: excelize.GraphicOptions{ScaleX: 1.5, ScaleY: 1.2},
+		}
+		for i := range topBins {
+			binChart.Series = append(binChart.Series, series(6+i))
+		}
+		if err := f.AddChart(sheetName, chartCol+"22", binChart); err != nil {
+			return fmt.Errorf("创建图表失败: %w", err)
+		}
+	}
+
+	now := nowISO8601()
+	_ = f.SetDocProps(&excelize.DocProperties{Created: now, Modified: now, Creator: "deviceParser"})
+
+	return saveWorkbook(f, outputFilePath)
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+func nowISO8601() string {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	return time.Now().In(loc).Format("2006-01-02T15:04:05Z07:00")
+}
+
+// calculateApproxTextWidth 根据字符串内容估算其在Excel中的显示宽度
+func calculateApproxTextWidth(text string) float64 {
+	// 这是一个启发式计算：
+	// ASCII字符（数字、字母、英文符号）宽度计为 1
+	// 其他字符（如中文）宽度计为 2
+	// 最后增加一些内边距
+	width := 0.0
+	for _, r := range text {
+		if r <= 127 { // Is ASCII
+			width += 1.0
+		} else {
+			width += 2.0
+		}
+	}
+	return width + 3.0 // 增加 3 个字符的内边距，使显示效果更好
+}
+
+// waferID 返回报表中显示的扩散批号 "LOT-WAFER"，全部保留的重复晶圆加 #2、#3 后缀区分
+func waferID(result model.FileResult) string {
+	id := fmt.Sprintf("%s-%s", result.Lot, result.Wafer)
+	if result.Duplicate > 0 {
+		id += fmt.Sprintf("#%d", result.Duplicate)
+	}
+	return id
+}
+
+// FileNameStem 去掉扩展名并替换路径分隔符，用于生成每片晶圆的输出文件名，多晶圆文件附加块序号
+func FileNameStem(name string, block int) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if block > 0 {
+		name += fmt.Sprintf("_%d", block)
+	}
+	return name
+}
+
+// saveWorkbook 将工作簿写入同一目录下的临时文件，完成后重命名为目标文件
+// 写入失败时目标文件保持原样，其他程序也不会读到写了一半的文件
+func saveWorkbook(f *excelize.File, outputFilePath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(outputFilePath), "."+filepath.Base(outputFilePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后删除不存在的文件，返回的错误可以忽略
+
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("设置文件权限失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, outputFilePath); err != nil {
+		return fmt.Errorf("保存到磁盘失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+func TestFileNameStem(t *testing.T) {
+	tests := []struct {
+		name  string
+		block int
+		want  string
+	}{
+		{"LOT1-01.txt", 0, "LOT1-01"},
+		{"LOT1.zip/sub/02.txt", 0, "LOT1.zip_sub_02"},
+		{`dir\03.map`, 2, "dir_03_2"},
+	}
+	for _, tt := range tests {
+		if got := FileNameStem(tt.name, tt.block); got != tt.want {
+			t.Errorf("FileNameStem(%q, %d) = %q, want %q", tt.name, tt.block, got, tt.want)
+		}
+	}
+}
+
+// TestSaveWorkbook 覆盖已有文件时不留下临时文件，写入失败时原文件保持不变
+func TestSaveWorkbook(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "summary.xlsx")
+	if err := os.WriteFile(outPath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetCellValue("Sheet1", "A1", "new")
+	if err := saveWorkbook(f, outPath); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := excelize.OpenFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := saved.GetCellValue("Sheet1", "A1"); v != "new" {
+		t.Errorf("A1 = %q, want new", v)
+	}
+	saved.Close()
+	if info, err := os.Stat(outPath); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, %v", info.Mode(), err)
+	}
+
+	// 目标是文件夹时重命名失败，临时文件被清理
+	if err := saveWorkbook(f, dir); err == nil {
+		t.Error("saving over a directory: expected error")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory contains %d entries, want only summary.xlsx", len(entries))
+	}
+}
+
+// BenchmarkWriteSummary 数千片晶圆、数百个 bin 的汇总表
+func BenchmarkWriteSummary(b *testing.B) {
+	for _, size := range []struct{ wafers, bins int }{{100, 50}, {2000, 300}} {
+		b.Run(fmt.Sprintf("%dx%d", size.wafers, size.bins), func(b *testing.B) {
+			results := make([]model.FileResult, size.wafers)
+			for i := range results {
+				counts := make(map[string]int, size.bins)
+				for j := range size.bins {
+					counts[fmt.Sprintf("%03d", j+1)] = (i + j) % 97
+				}
+				results[i] = model.FileResult{FileName: fmt.Sprintf("LOT%d-%02d.txt", i/25, i%25+1), Lot: fmt.Sprintf("LOT%d", i/25), Wafer: fmt.Sprintf("%02d", i%25+1), Counts: counts}
+			}
+			outPath := filepath.Join(b.TempDir(), "summary.xlsx")
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := WriteSummary(outPath, "处理结果", results, goldenNames, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderWaferMapPNGTooLarge(t *testing.T) {
+	row := make([]string, 2048)
+	for i := range row {
+		row[i] = "001"
+	}
+	m := model.WaferMap{Rows: [][]string{row, row}}
+	// 2048×2 个 die，每个 64×64 像素，共 16M 像素，恰好等于上限
+	if err := RenderWaferMapPNG(io.Discard, m, nil, 64); err != nil {
+		t.Fatalf("at limit: %v", err)
+	}
+	m.Rows = append(m.Rows, row)
+	if err := RenderWaferMapPNG(io.Discard, m, nil, 64); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("over limit: err = %v, want ErrImageTooLarge", err)
+	}
+}
+
+// TestWriteSummaryLongFileName 超长文件名不会使列宽超过 Excel 的上限而导致写入失败
+func TestWriteSummaryLongFileName(t *testing.T) {
+	name := strings.Repeat("a", 296) + ".txt"
+	results := []model.FileResult{{
+		FileName: name, Lot: "A1", Wafer: "01",
+		Counts: map[string]int{"001": 9, "005": 1},
+		Alarms: []model.Alarm{{Bin: "005", Kind: "数量", Value: 1, Limit: 0}},
+	}}
+	outcomes := []model.FileOutcome{{Path: "/maps/" + name, Name: name, Status: model.StatusOK}}
+	outPath := filepath.Join(t.TempDir(), "summary.xlsx")
+	if err := WriteSummary(outPath, "汇总", results, goldenNames, outcomes); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// 各工作表中文件名所在的列
+	for sheet, col := range map[string]string{"Sheet1": "A", "Alarms": "B", "Log": "A"} {
+		width, err := f.GetColWidth(sheet, col)
+		if err != nil || width != maxColWidth {
+			t.Errorf("%s column %s width = %v, %v, want %d", sheet, col, width, err, maxColWidth)
+		}
+	}
+}
+
+func TestWaferID(t *testing.T) {
+	if got := waferID(model.FileResult{Lot: "A", Wafer: "01"}); got != "A-01" {
+		t.Errorf("waferID = %q, want A-01", got)
+	}
+	if got := WaferTitle(model.FileResult{Lot: "A", Wafer: "01", Duplicate: 2}); got != "扩散批号：A-01#2" {
+		t.Errorf("WaferTitle = %q, want 扩散批号：A-01#2", got)
+	}
+}
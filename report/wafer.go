@@ -0,0 +1,106 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/model"
+)
+
+// Layout 独立文件模式下单片晶圆报表的版式
+type Layout string
+
+const (
+	LayoutTable      Layout = "table"      // 表格：与汇总表相同，每片晶圆一行
+	LayoutHorizontal Layout = "horizontal" // 横排：第 2 行为 bin 名称，第 3 行为数量
+)
+
+// LayoutLabels 界面中显示的版式名称，顺序即下拉框顺序
+var LayoutLabels = []struct {
+	Layout Layout
+	Label  string
+}{
+	{LayoutTable, "表格 (与汇总表相同)"},
+	{LayoutHorizontal, "横排 (名称一行、数量一行)"},
+}
+
+// ParseLayout 将用户输入转换为版式
+func ParseLayout(s string) (Layout, error) {
+	for _, item := range LayoutLabels {
+		if string(item.Layout) == s {
+			return item.Layout, nil
+		}
+	}
+	return "", fmt.Errorf("未知的报表版式: %s (可选 table/horizontal)", s)
+}
+
+// WaferTitle 返回单片晶圆报表的标题 "扩散批号：LOT-WAFER"，缺少 LOT 或 WAFER 时为 "未知"
+func WaferTitle(result model.FileResult) string {
+	if result.Lot == "" || result.Wafer == "" {
+		return "未知"
+	}
+	return "扩散批号：" + waferID(result)
+}
+
+// WriteWafer 按所选版式为单片晶圆生成报表，标题由 LOT/WAFER 生成
+func WriteWafer(outputFilePath string, result model.FileResult, names model.BinNames, layout Layout) error {
+	if layout == LayoutHorizontal {
+		return writeHorizontal(outputFilePath, result, names)
+	}
+	return WriteSummary(outputFilePath, WaferTitle(result), []model.FileResult{result}, names, nil)
+}
+
+// writeHorizontal 横排版式：第 1 行为跨列标题，第 2 行为 "名称 (编号)"，第 3 行为数量，列宽按内容估算
+func writeHorizontal(outputFilePath string, result model.FileResult, names model.BinNames) error {
+	keys := make([]string, 0, len(result.Counts))
+	for k := range result.Counts {
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return model.ErrNoData
+	}
+	sort.Strings(keys)
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheetName := "Sheet1"
+
+	// 标题横跨所有数据列
+	endCol, _ := excelize.ColumnNumberToName(len(keys))
+	f.MergeCell(sheetName, "A1", endCol+"1")
+	titleStyle, _ := f.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		Font:      &excelize.Font{Bold: true, Size: 12},
+	})
+	f.SetCellStyle(sheetName, "A1", endCol+"1", titleStyle)
+	f.SetCellValue(sheetName, "A1", WaferTitle(result))
+
+	centeredStyle, _ := f.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	for i, key := range keys {
+		colName, _ := excelize.ColumnNumberToName(i + 1)
+		header := fmt.Sprintf("%s (%s)", names.Name(key), key)
+		count := result.Counts[key]
+
+		f.SetCellValue(sheetName, colName+"2", header)
+		f.SetCellValue(sheetName, colName+"3", count)
+		f.SetCellStyle(sheetName, colName+"2", colName+"3", centeredStyle)
+
+		// 列宽取名称与数量两者中较宽的一个
+		width := max(calculateApproxTextWidth(header), calculateApproxTextWidth(fmt.Sprint(count)))
+		f.SetColWidth(sheetName, colName, colName, width)
+	}
+
+	now := nowISO8601()
+	_ = f.SetDocProps(&excelize.DocProperties{
+		Created:     now,
+		Modified:    now,
+		Creator:     "deviceParser",
+		Description: "RowData Results",
+	})
+
+	return saveWorkbook(f, outputFilePath)
+}
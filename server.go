@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"deviceParser/mapping"
+	"deviceParser/model"
+	"deviceParser/parser"
+	"deviceParser/report"
+)
+
+// maxUploadBytes 单次请求允许上传的最大字节数
+const maxUploadBytes = 64 << 20
+
+// profileNamePattern 配置名只允许字母、数字、下划线、点和连字符，避免路径穿越
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// apiServer 本地 HTTP 接口，供 MES 侧工具和内部网页调用解析与报表功能
+//
+//	POST /api/parse?format=json|xlsx|png&profile=名称  上传 map 文件或 .zip/.gz 压缩包 (请求体或 multipart 批量)
+//	GET  /api/profiles                                 列出已保存的映射配置
+//	GET  /api/profiles/{name}                          读取映射配置
+//	PUT  /api/profiles/{name}                          保存映射配置
+//
+// 每个请求使用独立的配置副本，不修改默认配置；接口只做静态 SBL 检查，不写入 SPC 历史
+type apiServer struct {
+	ProfileDir string          // 映射配置保存目录，文件名为 <name>.json
+	Defaults   mapping.Profile // 请求未指定配置时使用
+	Rules      []mapping.Rule
+}
+
+// apiResult 单片晶圆的 JSON 结果
+type apiResult struct {
+	FileName string            `json:"fileName"`
+	Lot      string            `json:"lot"`
+	Wafer    string            `json:"wafer"`
+	Counts   map[string]int    `json:"counts"`
+	Total    int               `json:"total"`
+	Yield    float64           `json:"yield"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Alarms   []apiAlarm        `json:"alarms,omitempty"`
+}
+
+// apiAlarm 超限记录的 JSON 形式
+type apiAlarm struct {
+	Bin     string  `json:"bin,omitempty"`
+	Kind    string  `json:"kind"`
+	Value   float64 `json:"value"`
+	Limit   float64 `json:"limit"`
+	Message string  `json:"message"`
+}
+
+// routes 返回注册了全部接口的 Handler
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/parse", s.handleParse)
+	mux.HandleFunc("GET /api/profiles", s.handleListProfiles)
+	mux.HandleFunc("GET /api/profiles/{name}", s.handleGetProfile)
+	mux.HandleFunc("PUT /api/profiles/{name}", s.handlePutProfile)
+	return mux
+}
+
+// writeJSON 以 JSON 格式输出响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError 以 {"error": "..."} 格式输出错误
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// profilePath 返回配置文件路径，配置名不合法时返回错误
+func (s *apiServer) profilePath(name string) (string, error) {
+	if !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("配置名 %q 不合法", name)
+	}
+	return filepath.Join(s.ProfileDir, name+".json"), nil
+}
+
+// profileFor 返回请求指定的映射配置，未指定时使用默认配置
+// 配置中未设置前缀时报表使用 mapping.DefaultPrefix
+func (s *apiServer) profileFor(r *http.Request) (mapping.Profile, error) {
+	profile := s.Defaults
+	if name := r.URL.Query().Get("profile"); name != "" {
+		filePath, err := s.profilePath(name)
+		if err != nil {
+			return mapping.Profile{}, err
+		}
+		if profile, err = mapping.LoadProfile(filePath); err != nil {
+			return mapping.Profile{}, err
+		}
+	}
+	return profile, nil
+}
+
+// saveUploads 将上传的文件保存到临时目录，返回保存后的路径
+// multipart 请求中所有字段的文件都会保存；普通请求体使用 name 参数作为文件名
+func saveUploads(r *http.Request, dir string) ([]string, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+			return nil, fmt.Errorf("解析上传内容失败: %w", err)
+		}
+		var paths []string
+		fields := make([]string, 0, len(r.MultipartForm.File))
+		for field := range r.MultipartForm.File {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			for _, header := range r.MultipartForm.File[field] {
+				src, err := header.Open()
+				if err != nil {
+					return nil, fmt.Errorf("读取上传文件失败: %w", err)
+				}
+				filePath, err := saveUpload(dir, header.Filename, len(paths), src)
+				src.Close()
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, filePath)
+			}
+		}
+		return paths, nil
+	}
+
+	filePath, err := saveUpload(dir, r.URL.Query().Get("name"), 0, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return []string{filePath}, nil
+}
+
+// saveUpload 保存单个上传文件，文件名只保留最后一段；同名文件放在不同子目录中，报表中的文件名保持不变
+func saveUpload(dir, name string, index int, src io.Reader) (string, error) {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "upload.txt"
+	}
+	subDir := filepath.Join(dir, strconv.Itoa(index))
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		return "", fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	filePath := filepath.Join(subDir, name)
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("保存上传文件失败: %w", err)
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", fmt.Errorf("保存上传文件失败: %w", err)
+	}
+	return filePath, nil
+}
+
+// handleParse 解析上传的 map 文件，按 format 参数返回 JSON 计数、汇总 Excel 或晶圆图 PNG
+func (s *apiServer) handleParse(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "xlsx" && format != "png" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("不支持的格式 %q，可选 json、xlsx、png", format))
+		return
+	}
+	profile, err := s.profileFor(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	dir, err := os.MkdirTemp("", "deviceParser-api-")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	paths, err := saveUploads(r, dir)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "没有上传文件")
+		return
+	}
+	// 上传的 .zip/.gz 展开为其中的 .txt 文件，文件名显示为 "压缩包名/包内路径"
+	archives := parser.NewArchives()
+	defer archives.Close()
+	paths, failed, err := parser.CollectFiles(paths, archives)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(failed) > 0 {
+		writeJSONError(w, http.StatusUnsupportedMediaType, failed[0].Detail)
+		return
+	}
+	parserOpts := profile.ParserOptions()
+	parserOpts.Archives = archives
+	if len(paths) == 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "上传的压缩包中没有 .txt 文件")
+		return
+	}
+
+	if format == "png" {
+		s.writeMapPNG(w, r, paths, profile, parserOpts)
+		return
+	}
+
+	var results []model.FileResult
+	for _, fPath := range paths {
+		fileResults, err := parser.ParseFile(fPath, parserOpts)
+		if err != nil {
+			if errors.Is(err, model.ErrNoData) {
+				continue
+			}
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("解析文件 %s 失败: %v", filepath.Base(fPath), err))
+			return
+		}
+		for _, result := range fileResults {
+			results = append(results, mapping.RebinCounts(s.Rules, result))
+		}
+	}
+	if len(results) == 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "上传的文件中没有数据")
+		return
+	}
+	mapping.ApplyLimits(results, profile.Limits(), profile.GoodBins)
+
+	if format == "json" {
+		response := make([]apiResult, 0, len(results))
+		for _, result := range results {
+			item := apiResult{
+				FileName: result.FileName,
+				Lot:      result.Lot,
+				Wafer:    result.Wafer,
+				Counts:   result.Counts,
+				Total:    result.TotalDies(),
+				Yield:    result.Yield(profile.GoodBins),
+				Metadata: result.Metadata,
+			}
+			for _, a := range result.Alarms {
+				item.Alarms = append(item.Alarms, apiAlarm{Bin: a.Bin, Kind: a.Kind, Value: a.Value, Limit: a.Limit, Message: a.String()})
+			}
+			response = append(response, item)
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		title = "处理结果"
+	}
+	outFilePath := filepath.Join(dir, "summary.xlsx")
+	if err := report.WriteSummary(outFilePath, title, results, profile.BinNames(), nil); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	content, err := os.ReadFile(outFilePath)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="summary.xlsx"`)
+	w.Write(content)
+}
+
+// writeMapPNG 返回单个文件的晶圆图，cell 参数为每个 die 的像素大小，多晶圆文件以 block 参数选择第几片 (默认第 1 片)
+func (s *apiServer) writeMapPNG(w http.ResponseWriter, r *http.Request, paths []string, profile mapping.Profile, parserOpts parser.Options) {
+	if len(paths) != 1 {
+		writeJSONError(w, http.StatusBadRequest, "png 格式一次只能上传一个 map 文件 (压缩包中也只能有一个)")
+		return
+	}
+	cellSize := 8
+	if cell := r.URL.Query().Get("cell"); cell != "" {
+		n, err := strconv.Atoi(cell)
+		if err != nil || n < 2 || n > 64 {
+			writeJSONError(w, http.StatusBadRequest, "cell 应为 2-64 之间的整数")
+			return
+		}
+		cellSize = n
+	}
+	block := 1
+	if b := r.URL.Query().Get("block"); b != "" {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 1 {
+			writeJSONError(w, http.StatusBadRequest, "block 应为正整数")
+			return
+		}
+		block = n
+	}
+
+	maps, err := parser.ReadWaferMaps(paths[0], parserOpts)
+	if errors.Is(err, model.ErrNoData) {
+		writeJSONError(w, http.StatusUnprocessableEntity, "上传的文件中没有数据")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if block > len(maps) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("文件中只有 %d 片晶圆", len(maps)))
+		return
+	}
+	m := mapping.RebinWaferMap(s.Rules, maps[block-1])
+
+	// 先绘制到内存中，出错时仍能返回 JSON 错误
+	var buf bytes.Buffer
+	if err := report.RenderWaferMapPNG(&buf, m, profile.GoodBins, cellSize); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, report.ErrImageTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// handleListProfiles 列出配置目录中的全部配置名
+func (s *apiServer) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(s.ProfileDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	names := []string{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if !entry.IsDir() && name != entry.Name() && profileNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// handleGetProfile 返回指定的映射配置
+func (s *apiServer) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	filePath, err := s.profilePath(r.PathValue("name"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	profile, err := mapping.LoadProfile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "配置不存在")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// handlePutProfile 校验并保存映射配置
+func (s *apiServer) handlePutProfile(w http.ResponseWriter, r *http.Request) {
+	filePath, err := s.profilePath(r.PathValue("name"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadBytes))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	profile, err := mapping.ParseProfile(content)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := os.MkdirAll(s.ProfileDir, 0755); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := mapping.SaveProfile(filePath, profile); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// defaultProfileDir 返回默认的配置保存目录 (用户配置目录下)
+func defaultProfileDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("无法定位用户配置目录: %w", err)
+	}
+	return filepath.Join(dir, "deviceParser", "profiles"), nil
+}
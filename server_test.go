@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"deviceParser/mapping"
+)
+
+// newTestServer 返回使用临时配置目录的接口服务，已保存名为 good 的配置 (良品 bin 为 001)
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "profiles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	profile := mapping.Profile{Prefix: mapping.DefaultPrefix, Names: map[string]string{}, GoodBins: []string{"001"}}
+	if err := mapping.SaveProfile(filepath.Join(dir, "good.json"), profile); err != nil {
+		t.Fatal(err)
+	}
+	s := &apiServer{ProfileDir: dir, Defaults: mapping.Profile{Prefix: mapping.DefaultPrefix, Names: map[string]string{}}}
+	server := httptest.NewServer(s.routes())
+	t.Cleanup(server.Close)
+	return server, dir
+}
+
+func readTestMap(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "maps", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// do 发送请求并返回状态码与响应体
+func do(t *testing.T, method, url, contentType string, body []byte) (int, http.Header, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header, buf.Bytes()
+}
+
+func TestParseJSON(t *testing.T) {
+	server, _ := newTestServer(t)
+	status, header, body := do(t, "POST", server.URL+"/api/parse?profile=good&name=basic.txt", "text/plain", readTestMap(t, "basic.txt"))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	if !strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		t.Errorf("content type = %q", header.Get("Content-Type"))
+	}
+	var results []apiResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results = %d, want 1", len(results))
+	}
+	r := results[0]
+	if r.FileName != "basic.txt" || r.Lot != "A12345" || r.Wafer != "01" || r.Total != 24 || r.Counts["001"] != 20 || r.Yield != 20.0/24*100 {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestParseXLSX(t *testing.T) {
+	server, _ := newTestServer(t)
+	status, header, body := do(t, "POST", server.URL+"/api/parse?format=xlsx&title=T&name=multi.txt", "", readTestMap(t, "multi_wafer.txt"))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	if header.Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Errorf("content type = %q", header.Get("Content-Type"))
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if title, _ := f.GetCellValue(f.GetSheetName(0), "A1"); title != "T" {
+		t.Errorf("title = %q, want T", title)
+	}
+}
+
+func TestParsePNG(t *testing.T) {
+	server, _ := newTestServer(t)
+	url := server.URL + "/api/parse?format=png&cell=4&block=2&name=multi.txt"
+	status, header, body := do(t, "POST", url, "", readTestMap(t, "multi_wafer.txt"))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	if header.Get("Content-Type") != "image/png" {
+		t.Errorf("content type = %q", header.Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 16 || size.Y != 12 {
+		t.Errorf("size = %v, want 16x12", size)
+	}
+
+	for _, query := range []string{"cell=1", "block=0", "block=3"} {
+		status, _, body := do(t, "POST", server.URL+"/api/parse?format=png&"+query, "", readTestMap(t, "multi_wafer.txt"))
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %s", query, status, body)
+		}
+	}
+}
+
+func TestParsePNGTooLarge(t *testing.T) {
+	server, _ := newTestServer(t)
+	// 4097 个 die，每个 64×64 像素，超过 MaxImagePixels
+	content := "LOT: A1\nWAFER: 01\nRowData:" + strings.Repeat(" 001", 4097) + "\n"
+	status, header, body := do(t, "POST", server.URL+"/api/parse?format=png&cell=64", "", []byte(content))
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413: %s", status, body)
+	}
+	if !strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		t.Errorf("content type = %q", header.Get("Content-Type"))
+	}
+}
+
+func TestParseMultipart(t *testing.T) {
+	server, _ := newTestServer(t)
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	// 同名文件分别保存，互不覆盖；文件名中的目录部分被去掉
+	files := []struct{ field, name, src string }{
+		{"a", "basic.txt", "basic.txt"},
+		{"b", "../../multi.txt", "multi_wafer.txt"},
+		{"b", `C:\maps\basic.txt`, "multi_wafer.txt"},
+	}
+	for _, f := range files {
+		part, err := mw.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(readTestMap(t, f.src))
+	}
+	mw.Close()
+
+	status, _, body := do(t, "POST", server.URL+"/api/parse", mw.FormDataContentType(), buf.Bytes())
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	var results []apiResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.FileName+":"+r.Lot+"-"+r.Wafer)
+	}
+	want := "basic.txt:A12345-01 multi.txt:B20001-02 multi.txt:B20001-03 basic.txt:B20001-02 basic.txt:B20001-03"
+	if strings.Join(got, " ") != want {
+		t.Errorf("results = %v, want %s", got, want)
+	}
+
+	// png 格式一次只能上传一个文件
+	status, _, _ = do(t, "POST", server.URL+"/api/parse?format=png", mw.FormDataContentType(), buf.Bytes())
+	if status != http.StatusBadRequest {
+		t.Errorf("png batch: status = %d, want 400", status)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	server, _ := newTestServer(t)
+	tests := []struct {
+		name   string
+		query  string
+		body   string
+		status int
+	}{
+		{"bad format", "format=pdf", "LOT: A\nWAFER: 1\nRowData: 001\n", http.StatusBadRequest},
+		{"missing profile", "profile=nope", "LOT: A\nWAFER: 1\nRowData: 001\n", http.StatusBadRequest},
+		{"no data", "", "LOT: A\nWAFER: 1\n", http.StatusUnprocessableEntity},
+		{"bad archive", "name=maps.zip", "not a zip", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := do(t, "POST", server.URL+"/api/parse?"+tt.query, "", []byte(tt.body))
+			if status != tt.status {
+				t.Errorf("status = %d, want %d: %s", status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestProfilePath(t *testing.T) {
+	s := &apiServer{ProfileDir: "profiles"}
+	for _, name := range []string{"good", "line-2_v1.0"} {
+		if got, err := s.profilePath(name); err != nil || got != filepath.Join("profiles", name+".json") {
+			t.Errorf("profilePath(%q) = %q, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"", "..", "../evil", "a/b", `a\b`, ".hidden", "a b"} {
+		if _, err := s.profilePath(name); err == nil {
+			t.Errorf("profilePath(%q) accepted", name)
+		}
+	}
+}
+
+func TestProfileTraversal(t *testing.T) {
+	server, dir := newTestServer(t)
+	profile := []byte(`{"prefix": "Bin", "names": {"001": "Pass"}}`)
+
+	for _, name := range []string{"..%2Fevil", "%2E%2E%2F%2E%2E%2Fevil", "a%5Cevil", ".evil"} {
+		status, _, body := do(t, "PUT", server.URL+"/api/profiles/"+name, "application/json", profile)
+		if status != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want 400: %s", name, status, body)
+		}
+		status, _, _ = do(t, "GET", server.URL+"/api/profiles/"+name, "", nil)
+		if status != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want 400", name, status)
+		}
+	}
+	status, _, _ := do(t, "POST", server.URL+"/api/parse?profile=..%2Fevil", "", readTestMap(t, "basic.txt"))
+	if status != http.StatusBadRequest {
+		t.Errorf("parse with traversal profile: status = %d, want 400", status)
+	}
+	for _, path := range []string{filepath.Join(dir, "..", "evil.json"), filepath.Join(dir, "..", "..", "evil.json")} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s was written", path)
+		}
+	}
+
+	// 合法的配置名可以保存、读取并出现在列表中
+	if status, _, body := do(t, "PUT", server.URL+"/api/profiles/line2", "application/json", profile); status != http.StatusOK {
+		t.Fatalf("PUT line2: status = %d: %s", status, body)
+	}
+	status, _, body := do(t, "GET", server.URL+"/api/profiles/line2", "", nil)
+	var got mapping.Profile
+	if status != http.StatusOK || json.Unmarshal(body, &got) != nil || got.Prefix != "Bin" {
+		t.Errorf("GET line2: status = %d, body = %s", status, body)
+	}
+	status, _, body = do(t, "GET", server.URL+"/api/profiles", "", nil)
+	if status != http.StatusOK || strings.TrimSpace(string(body)) != `["good","line2"]` {
+		t.Errorf("list: status = %d, body = %s", status, body)
+	}
+	if status, _, _ := do(t, "GET", server.URL+"/api/profiles/missing", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET missing: status = %d, want 404", status)
+	}
+}
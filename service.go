@@ -1,99 +1,24 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
-	"github.com/xuri/excelize/v2"
-)
-
-// extractKeysFromFile 从文件中提取所有唯一的编号
-func extractKeysFromFile(filePath string) ([]string, error) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("读取文件失败: %w", err)
-	}
-
-	lines := strings.Split(string(content), "\n")
-	keySet := make(map[string]struct{}) // 使用map来保证key的唯一性
-
-	for _, line := range lines {
-		cleanLine := strings.TrimSpace(line)
-		if strings.HasPrefix(cleanLine, "RowData:") {
-			fields := strings.Fields(strings.TrimPrefix(cleanLine, "RowData:"))
-			for _, field := range fields {
-				if field != "___" {
-					keySet[field] = struct{}{}
-				}
-			}
-		}
-	}
-
-	// 将map的key转换为slice并排序
-	keys := make([]string, 0, len(keySet))
-	for k := range keySet {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	return keys, nil
-}
-
-// extractDataFromFile 只负责从单个文件中提取数据
-func extractDataFromFile(filePath string) (fileResult, error) {
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return fileResult{}, fmt.Errorf("读取文件失败: %w", err)
-	}
-
-	lines := strings.Split(string(content), "\n")
-	counts := make(map[string]int)
-	var lot, wafer string
-
-	for _, line := range lines {
-		cleanLine := strings.TrimSpace(line)
-		if strings.HasPrefix(cleanLine, "LOT:") {
-			lot = strings.TrimSpace(strings.TrimPrefix(cleanLine, "LOT:"))
-		} else if strings.HasPrefix(cleanLine, "WAFER:") {
-			wafer = strings.TrimSpace(strings.TrimPrefix(cleanLine, "WAFER:"))
-		} else if strings.HasPrefix(cleanLine, "RowData:") {
-			fields := strings.Fields(strings.TrimPrefix(cleanLine, "RowData:"))
-			for _, field := range fields {
-				if field != "___" && field != "..." {
-					counts[field]++
-				}
-			}
-		}
-	}
-
-	if len(counts) == 0 {
-		return fileResult{
-			FileName: filepath.Base(filePath),
-			Lot:      lot,
-			Wafer:    wafer,
-			Counts:   counts,
-		}, ErrNoData
-	}
 
-	return fileResult{
-		FileName: filepath.Base(filePath),
-		Lot:      lot,
-		Wafer:    wafer,
-		Counts:   counts,
-	}, nil
-}
+	"deviceParser/analysis"
+	"deviceParser/model"
+	"deviceParser/parser"
+	"deviceParser/report"
+	"deviceParser/store"
+)
 
-func configButtonClickHandler(itemListBinding binding.List[string], parentWindow fyne.Window, myApp fyne.App) {
+func configButtonClickHandler(itemListBinding binding.List[string], parentWindow fyne.Window, myApp fyne.App, cfg *settings) {
 	items, _ := itemListBinding.Get()
 	if len(items) == 0 {
 		dialog.ShowError(fmt.Errorf("请先添加文件或选择一个文件夹！"), parentWindow)
@@ -102,29 +27,20 @@ func configButtonClickHandler(itemListBinding binding.List[string], parentWindow
 
 	inputPath := items[0] // 第一个（也是唯一一个）项是文件或文件夹
 
-	// 检查是文件还是文件夹
-	fileInfo, err := os.Stat(inputPath)
+	// 文件夹扫描其中的 .txt 文件及压缩包，压缩包展开为包内的 .txt 文件
+	archives := parser.NewArchives()
+	defer archives.Close()
+	filesToScan, failed, err := parser.CollectFiles([]string{inputPath}, archives)
 	if err != nil {
-		dialog.ShowError(fmt.Errorf("无法访问路径: %w", err), parentWindow)
+		dialog.ShowError(err, parentWindow)
 		return
 	}
-
-	var filesToScan []string
-	if fileInfo.IsDir() {
-		// 如果是文件夹, 扫描所有.txt文件
-		entries, err := os.ReadDir(inputPath)
-		if err != nil {
-			dialog.ShowError(fmt.Errorf("读取文件夹失败: %w", err), parentWindow)
-			return
+	if len(failed) > 0 {
+		var details []string
+		for _, o := range failed {
+			details = append(details, o.Detail)
 		}
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".txt") {
-				filesToScan = append(filesToScan, filepath.Join(inputPath, entry.Name()))
-			}
-		}
-	} else {
-		// 如果是文件
-		filesToScan = append(filesToScan, inputPath)
+		dialog.ShowError(fmt.Errorf("以下压缩包无法打开，已跳过:\n%s", strings.Join(details, "\n")), parentWindow)
 	}
 
 	if len(filesToScan) == 0 {
@@ -133,9 +49,11 @@ func configButtonClickHandler(itemListBinding binding.List[string], parentWindow
 	}
 
 	// 汇总所有文件的 keys
+	parserOpts := cfg.Profile.ParserOptions()
+	parserOpts.Archives = archives
 	allKeysSet := make(map[string]struct{})
 	for _, filePath := range filesToScan {
-		keys, err := extractKeysFromFile(filePath)
+		keys, err := parser.Keys(filePath, parserOpts)
 		if err != nil {
 			dialog.ShowError(fmt.Errorf("解析文件 %s 失败: %w", filePath, err), parentWindow)
 			return
@@ -151,13 +69,16 @@ func configButtonClickHandler(itemListBinding binding.List[string], parentWindow
 	}
 	sort.Strings(sortedAllKeys)
 	for _, key := range sortedAllKeys {
-		dynamicBinNameMapping[key] = defaultPrefix + key
+		// 保留从映射配置中加载或之前编辑过的名称
+		if _, ok := cfg.Profile.Names[key]; !ok {
+			cfg.Profile.Names[key] = cfg.Profile.Prefix + key
+		}
 	}
-	showMappingEditor(myApp, sortedAllKeys)
+	showMappingEditor(myApp, sortedAllKeys, cfg.Profile.Names)
 }
 
 // showMappingEditor 映射配置窗口
-func showMappingEditor(a fyne.App, keys []string) {
+func showMappingEditor(a fyne.App, keys []string, names map[string]string) {
 	editorWindow := a.NewWindow("配置编号和名称的映射关系")
 	editorWindow.Resize(fyne.NewSize(500, 400))
 
@@ -167,7 +88,7 @@ func showMappingEditor(a fyne.App, keys []string) {
 	refreshList := func() {
 		var items []string
 		for _, k := range keys {
-			if name, ok := dynamicBinNameMapping[k]; ok {
+			if name, ok := names[k]; ok {
 				items = append(items, fmt.Sprintf("%s -> %s", k, name))
 			} else {
 				items = append(items, k)
@@ -196,7 +117,7 @@ func showMappingEditor(a fyne.App, keys []string) {
 		selectedKeyLabel.SetText(fmt.Sprintf("为编号 [%s] 设置名称:", selectedKey))
 
 		// 如果已存在映射，则预填入输入框
-		if name, ok := dynamicBinNameMapping[selectedKey]; ok {
+		if name, ok := names[selectedKey]; ok {
 			nameEntry.SetText(name)
 		} else {
 			nameEntry.SetText("")
@@ -212,7 +133,7 @@ func showMappingEditor(a fyne.App, keys []string) {
 
 	saveButton := widget.NewButton("保存", func() {
 		if selectedKey != "" && strings.TrimSpace(nameEntry.Text) != "" {
-			dynamicBinNameMapping[selectedKey] = nameEntry.Text
+			names[selectedKey] = nameEntry.Text
 			refreshList()      // 刷新列表以显示更新后的映射
 			list.UnselectAll() // 清除选择状态
 		}
@@ -240,169 +161,215 @@ func showMappingEditor(a fyne.App, keys []string) {
 	editorWindow.Show()
 }
 
-// processDataLogic 函数 (保持不变)
-func processDataLogic(inputFilePath string, outputFilePath string, mapping map[string]string) error {
-	// ... 此函数内部逻辑与上一版本完全相同 ...
-	content, err := os.ReadFile(inputFilePath)
-	if err != nil {
-		return fmt.Errorf("读取文件失败: %w", err)
-	}
-	lines := strings.Split(string(content), "\n")
-	var lot, wafer string
-	counts := make(map[string]int)
-	for _, line := range lines {
-		cleanLine := strings.TrimSpace(line)
-		if strings.HasPrefix(cleanLine, "LOT:") {
-			lot = strings.TrimSpace(strings.TrimPrefix(cleanLine, "LOT:"))
-		} else if strings.HasPrefix(cleanLine, "WAFER:") {
-			wafer = strings.TrimSpace(strings.TrimPrefix(cleanLine, "WAFER:"))
-		} else if strings.HasPrefix(cleanLine, "RowData:") {
-			fields := strings.Fields(strings.TrimPrefix(cleanLine, "RowData:"))
-			for _, field := range fields {
-				if field != "___" && field != "..." {
-					counts[field]++
-				}
+// showHistoryWindow 历史查询窗口：按 LOT 前缀、产品和日期范围查询本地数据库
+func showHistoryWindow(a fyne.App, cfg *settings) {
+	historyWindow := a.NewWindow("历史良率查询")
+	historyWindow.Resize(fyne.NewSize(800, 500))
+
+	lotEntry := widget.NewEntry()
+	lotEntry.SetPlaceHolder("LOT 前缀")
+	productEntry := widget.NewEntry()
+	productEntry.SetPlaceHolder("产品名")
+	fromEntry := widget.NewEntry()
+	fromEntry.SetPlaceHolder("起始日期 YYYY-MM-DD")
+	toEntry := widget.NewEntry()
+	toEntry.SetPlaceHolder("结束日期 YYYY-MM-DD (含)")
+	countLabel := widget.NewLabel("")
+
+	headers := []string{"运行时间", "产品", "扩散批号", "die数", "良率", "文件名"}
+	var rows [][]string
+	var wafers []store.Wafer
+	var results []model.FileResult
+
+	table := widget.NewTable(
+		func() (int, int) { return len(rows) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("template text") },
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			label := o.(*widget.Label)
+			if id.Row == 0 {
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				label.SetText(headers[id.Col])
+				return
 			}
-		}
-	}
-	var records []record
-	var sortedKeys []string
-	for k := range counts {
-		sortedKeys = append(sortedKeys, k)
+			label.TextStyle = fyne.TextStyle{}
+			label.SetText(rows[id.Row-1][id.Col])
+		},
+	)
+	for i, w := range []float32{160, 100, 160, 70, 80, 200} {
+		table.SetColumnWidth(i, w)
 	}
-	sort.Strings(sortedKeys)
 
-	// --- 这里是唯一的、关键的修改点 ---
-	for _, key := range sortedKeys {
-		// 首先，尝试从用户配置的映射中获取名称
-		name, ok := mapping[key]
-
-		// 如果在映射中找不到 (ok == false)，则应用默认命名规则
-		if !ok {
-			name = defaultPrefix + key
+	queryButton := widget.NewButton("查询", func() {
+		q := store.Query{Lot: strings.TrimSpace(lotEntry.Text), Product: strings.TrimSpace(productEntry.Text)}
+		var err error
+		if q.From, err = parseDateFlag(strings.TrimSpace(fromEntry.Text)); err != nil {
+			dialog.ShowError(err, historyWindow)
+			return
+		}
+		if q.To, err = parseDateFlag(strings.TrimSpace(toEntry.Text)); err != nil {
+			dialog.ShowError(err, historyWindow)
+			return
+		}
+		if !q.To.IsZero() {
+			q.To = q.To.AddDate(0, 0, 1)
 		}
 
-		// 此时，name 要么是用户的自定义名称，要么是 "BIN" + key
-		records = append(records, record{name: name, key: key, count: counts[key]})
-	}
+		dbPath, err := store.DefaultPath()
+		if err != nil {
+			dialog.ShowError(err, historyWindow)
+			return
+		}
+		db, err := store.Open(dbPath)
+		if err != nil {
+			dialog.ShowError(err, historyWindow)
+			return
+		}
+		defer db.Close()
 
-	f := excelize.NewFile()
-	defer f.Close()
-	sheetName := "Sheet1"
-	title := "未知"
-	if lot != "" && wafer != "" {
-		title = fmt.Sprintf("扩散批号：%s-%s", lot, wafer)
-	}
-	if len(records) > 0 {
-		endCell, _ := excelize.CoordinatesToCellName(len(records), 1)
-		f.MergeCell(sheetName, "A1", endCell)
-	}
+		wafers, err = db.Query(q)
+		if err != nil {
+			dialog.ShowError(err, historyWindow)
+			return
+		}
+		rows, results = nil, nil
+		for _, w := range wafers {
+			result := w.ToFileResult()
+			rows = append(rows, []string{
+				w.RunTime.Local().Format("2006-01-02 15:04:05"),
+				w.Product,
+				w.Lot + "-" + w.Wafer,
+				fmt.Sprintf("%d", result.TotalDies()),
+				fmt.Sprintf("%.2f%%", result.Yield(cfg.Profile.GoodBins)),
+				w.FileName,
+			})
+			results = append(results, result)
+		}
+		countLabel.SetText(fmt.Sprintf("共 %d 条记录", len(rows)))
+		table.Refresh()
+	})
+	queryButton.Importance = widget.HighImportance
 
-	// 计算总列数
-	numCols := len(records)
-	if numCols == 0 {
-		return ErrNoData
-	}
+	exportButton := widget.NewButton("导出 Excel", func() {
+		if len(results) == 0 {
+			dialog.ShowInformation("提示", "没有可导出的记录。", historyWindow)
+			return
+		}
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, historyWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			writer.Close()
 
-	// 合并单元格，横跨所有数据列
-	// 如果 numCols > 0, endCell 至少是 "A1"
-	endCellCol, _ := excelize.ColumnNumberToName(numCols)        // 将列号转换为列字母，例如 1 -> A, 2 -> B
-	f.MergeCell(sheetName, "A1", fmt.Sprintf("%s1", endCellCol)) // A1 到最后一列的1行
-
-	// 设置标题内容和样式（居中）
-	// 注意：这里的style只针对标题单元格有效，如果需要标题文字居中同时跨多列，需要设置Alignment
-	titleStyle, _ := f.NewStyle(&excelize.Style{
-		Alignment: &excelize.Alignment{
-			Horizontal: "center", // 水平居中
-			Vertical:   "center", // 垂直居中
-		},
-		Font: &excelize.Font{Bold: true, Size: 12}, // 标题字体加粗，大小可调
-	})
-	f.SetCellStyle(sheetName, "A1", fmt.Sprintf("%s1", endCellCol), titleStyle)
-	f.SetCellValue(sheetName, "A1", title)
-
-	// --- 创建居中样式，用于第二行和第三行 ---
-	centeredStyle, _ := f.NewStyle(&excelize.Style{
-		Alignment: &excelize.Alignment{
-			Horizontal: "center", // 水平居中
-			Vertical:   "center", // 垂直居中
-		},
+			if err := report.WriteSummary(writer.URI().Path(), "历史查询", results, cfg.Profile.BinNames(), nil); err != nil {
+				dialog.ShowError(fmt.Errorf("导出失败: %w", err), historyWindow)
+				return
+			}
+			dialog.ShowInformation("成功", fmt.Sprintf("已导出 %d 条记录", len(results)), historyWindow)
+		}, historyWindow)
+		fileDialog.SetFileName("history.xlsx")
+		resizeDialog(fileDialog, historyWindow)
+		fileDialog.Show()
 	})
+	exportButton.Importance = widget.MediumImportance
 
-	// --- 写入表头 (第二行) 和数据 (第三行) ---
-	for i, rec := range records {
-		colNum := i + 1
-		colName, _ := excelize.ColumnNumberToName(colNum)
-
-		// 准备要写入第二行和第三行的文本
-		textForRow2 := fmt.Sprintf("%s (%s)", rec.name, rec.key)
-		textForRow3 := fmt.Sprintf("%d", rec.count) // 将数字也转为字符串以便计算宽度
-
-		// 写入第二行
-		cell2 := fmt.Sprintf("%s2", colName)
-		f.SetCellValue(sheetName, cell2, textForRow2)
-		f.SetCellStyle(sheetName, cell2, cell2, centeredStyle)
-
-		// 写入第三行
-		cell3 := fmt.Sprintf("%s3", colName)
-		f.SetCellValue(sheetName, cell3, rec.count)
-		f.SetCellStyle(sheetName, cell3, cell3, centeredStyle)
-
-		// --- 动态计算并设置列宽 ---
-		// 1. 分别计算两行文本的估算宽度
-		width2 := calculateApproxTextWidth(textForRow2)
-		width3 := calculateApproxTextWidth(textForRow3)
-
-		// 2. 取两者中的最大值作为此列的宽度
-		maxWidth := width2
-		if width3 > maxWidth {
-			maxWidth = width3
+	trendButton := widget.NewButton("趋势报告", func() {
+		if len(wafers) == 0 {
+			dialog.ShowInformation("提示", "请先查询出需要分析的记录。", historyWindow)
+			return
 		}
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, historyWindow)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			writer.Close()
 
-		// 3. 应用计算出的宽度
-		f.SetColWidth(sheetName, colName, colName, maxWidth)
-	}
-
-	// --- 时区与 DocProps 设置 ---
-	// 使用系统全局 time.Local（在 main 中已设置为 Asia/Shanghai）
-	now := nowISO8601()
-	// 显式设置文档属性，避免 fallback 时间问题
-	_ = f.SetDocProps(&excelize.DocProperties{
-		Created:     now,
-		Modified:    now,
-		Creator:     "deviceParser",
-		Description: "RowData Results",
+			lots, topBins := analysis.BuildLotTrends(trendWafersFromStore(wafers), cfg.Profile.GoodBins, 5)
+			if err := report.WriteTrend(writer.URI().Path(), lots, topBins, cfg.Profile.BinNames()); err != nil {
+				dialog.ShowError(fmt.Errorf("生成趋势报告失败: %w", err), historyWindow)
+				return
+			}
+			dialog.ShowInformation("成功", fmt.Sprintf("已生成 %d 个 LOT 的趋势报告", len(lots)), historyWindow)
+		}, historyWindow)
+		fileDialog.SetFileName("trend.xlsx")
+		resizeDialog(fileDialog, historyWindow)
+		fileDialog.Show()
 	})
+	trendButton.Importance = widget.MediumImportance
 
-	// --- 将内容写入临时英文路径，然后重命名到目标路径 ---
-	buffer := new(bytes.Buffer)
-	if _, err := f.WriteTo(buffer); err != nil {
-		return fmt.Errorf("将Excel数据写入内存失败: %w", err)
-	}
+	form := container.NewVBox(
+		container.NewGridWithColumns(4, lotEntry, productEntry, fromEntry, toEntry),
+		container.NewBorder(nil, nil, nil, container.NewHBox(queryButton, exportButton, trendButton), countLabel),
+	)
+	historyWindow.SetContent(container.NewBorder(form, nil, nil, nil, table))
+	historyWindow.Show()
+}
 
-	// 临时文件名放在 os.TempDir() 下，尽量使用 ASCII 名称
-	tmpFileName := fmt.Sprintf("tmp_excel_%d.xlsx", time.Now().UnixNano())
-	tmpPath := filepath.Join(os.TempDir(), tmpFileName)
+// showOutcomeWindow 处理结果窗口：列出本次批处理中每个文件的状态，失败的文件排在前面
+func showOutcomeWindow(a fyne.App, outcomes []model.FileOutcome) {
+	outcomeWindow := a.NewWindow("处理结果")
+	outcomeWindow.Resize(fyne.NewSize(800, 400))
+
+	sorted := append([]model.FileOutcome(nil), outcomes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return !sorted[i].OK() && sorted[j].OK()
+	})
 
-	// 写入临时文件
-	if err := os.WriteFile(tmpPath, buffer.Bytes(), 0644); err != nil {
-		return fmt.Errorf("保存临时Excel文件失败: %w", err)
+	headers := []string{"文件名", "状态", "扩散批号", "说明"}
+	table := widget.NewTable(
+		func() (int, int) { return len(sorted) + 1, len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("template text") },
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			label := o.(*widget.Label)
+			if id.Row == 0 {
+				label.TextStyle = fyne.TextStyle{Bold: true}
+				label.Importance = widget.MediumImportance
+				label.SetText(headers[id.Col])
+				return
+			}
+			outcome := sorted[id.Row-1]
+			label.TextStyle = fyne.TextStyle{}
+			label.Importance = widget.MediumImportance
+			if !outcome.OK() && outcome.Status != model.StatusNoData {
+				label.Importance = widget.DangerImportance
+			}
+			waferID := ""
+			if outcome.Lot != "" || outcome.Wafer != "" {
+				waferID = fmt.Sprintf("%s-%s", outcome.Lot, outcome.Wafer)
+			}
+			label.SetText([]string{outcome.Name, string(outcome.Status), waferID, outcome.Detail}[id.Col])
+		},
+	)
+	for i, w := range []float32{180, 130, 140, 330} {
+		table.SetColumnWidth(i, w)
 	}
 
-	// 重命名到目标路径（覆盖同名文件）
-	if err := os.Rename(tmpPath, outputFilePath); err != nil {
-		// 如果跨设备移动失败（rare），尝试拷贝后删除
-		in, rerr := os.ReadFile(tmpPath)
-		if rerr != nil {
-			_ = os.Remove(tmpPath)
-			return fmt.Errorf("重命名临时文件失败: %v，且临时文件读取失败: %w", err, rerr)
+	// 校验问题逐条列在下方，格式为 文件:行:列: 严重程度: 说明
+	var diagLines []string
+	for _, o := range outcomes {
+		for _, d := range o.Diagnostics {
+			diagLines = append(diagLines, d.String())
 		}
-		if werr := os.WriteFile(outputFilePath, in, 0644); werr != nil {
-			_ = os.Remove(tmpPath)
-			return fmt.Errorf("重命名失败: %v；拷贝到目标失败: %w", err, werr)
-		}
-		_ = os.Remove(tmpPath)
 	}
-
-	return nil
+	if len(diagLines) == 0 {
+		outcomeWindow.SetContent(container.NewBorder(widget.NewLabel(model.OutcomeSummary(outcomes)), nil, nil, nil, table))
+		outcomeWindow.Show()
+		return
+	}
+	diagList := widget.NewList(
+		func() int { return len(diagLines) },
+		func() fyne.CanvasObject { return widget.NewLabel("template text") },
+		func(id widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(diagLines[id]) },
+	)
+	split := container.NewVSplit(table, container.NewBorder(widget.NewLabel(fmt.Sprintf("校验问题 (%d 条):", len(diagLines))), nil, nil, nil, diagList))
+	split.SetOffset(0.6)
+	outcomeWindow.SetContent(container.NewBorder(widget.NewLabel(model.OutcomeSummary(outcomes)), nil, nil, nil, split))
+	outcomeWindow.Show()
 }
@@ -0,0 +1,294 @@
+// Package spc 基于历史数据计算各 bin 占比的动态限值 (SPC)，并据此检查新的晶圆结果
+package spc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"deviceParser/model"
+)
+
+// Options 基于历史数据的动态限值 (SPC) 参数，配置在映射配置文件的 "spc" 字段中
+type Options struct {
+	Method      string  `json:"method"`                // sigma: 均值 ± k·标准差；mad: 中位数 ± k·1.4826·MAD
+	K           float64 `json:"k"`                     // 限值宽度系数，常用 3
+	MinSamples  int     `json:"minSamples,omitempty"`  // 历史样本不足该数量时不做判断，默认 10
+	HistoryFile string  `json:"historyFile,omitempty"` // 历史数据文件，默认位于用户配置目录
+	// IncludeOutliers 为 true 时超出动态限值的晶圆也写入历史；默认不写入，避免限值向异常值漂移
+	IncludeOutliers bool `json:"includeOutliers,omitempty"`
+}
+
+// HistoryRecord 历史数据文件中的一行，记录一片晶圆各 bin 的占比 (百分比)
+type HistoryRecord struct {
+	Product  string             `json:"product"`
+	Lot      string             `json:"lot"`
+	Wafer    string             `json:"wafer"`
+	Time     string             `json:"time"`
+	Percents map[string]float64 `json:"percents"`
+}
+
+// Limit 单个 bin 的动态限值
+type Limit struct {
+	Center  float64
+	Lower   float64
+	Upper   float64
+	Samples int
+}
+
+// Validate 检查参数并补全默认值
+func (o *Options) Validate() error {
+	if o.Method != "sigma" && o.Method != "mad" {
+		return fmt.Errorf("未知的 SPC 方法: %s (可选 sigma/mad)", o.Method)
+	}
+	if o.K <= 0 {
+		return fmt.Errorf("SPC 系数 k 必须大于 0")
+	}
+	if o.MinSamples <= 0 {
+		o.MinSamples = 10
+	} else if o.MinSamples < 2 {
+		o.MinSamples = 2 // 至少两个样本才能估计离散程度
+	}
+	return nil
+}
+
+// HistoryPath 返回历史数据文件的路径
+func (o Options) HistoryPath() (string, error) {
+	if o.HistoryFile != "" {
+		return o.HistoryFile, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("无法定位用户配置目录: %w", err)
+	}
+	return filepath.Join(dir, "deviceParser", "history.jsonl"), nil
+}
+
+// LoadHistory 读取历史数据，文件不存在时返回空
+// 同一产品的同一晶圆出现多次时以最后一次为准 (复测覆盖)
+func LoadHistory(filePath string) ([]HistoryRecord, error) {
+	f, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取历史数据失败: %w", err)
+	}
+	defer f.Close()
+
+	index := make(map[string]int)
+	var records []HistoryRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("历史数据第 %d 行格式错误: %w", lineNum, err)
+		}
+		key := rec.Product + "\x00" + rec.Lot + "\x00" + rec.Wafer
+		if i, ok := index[key]; ok {
+			records[i] = rec
+			continue
+		}
+		index[key] = len(records)
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取历史数据失败: %w", err)
+	}
+	return records, nil
+}
+
+// AppendHistory 将本次结果追加到历史数据文件
+func AppendHistory(filePath string, records []HistoryRecord) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("创建历史数据目录失败: %w", err)
+	}
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开历史数据失败: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("序列化历史数据失败: %w", err)
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("写入历史数据失败: %w", err)
+	}
+	return nil
+}
+
+// HistoryRecordsFor 将本次结果转换为历史记录
+func HistoryRecordsFor(results []model.FileResult, product string) []HistoryRecord {
+	now := time.Now().Format(time.RFC3339)
+	records := make([]HistoryRecord, 0, len(results))
+	for _, result := range results {
+		records = append(records, HistoryRecord{
+			Product:  product,
+			Lot:      result.Lot,
+			Wafer:    result.Wafer,
+			Time:     now,
+			Percents: result.BinPercents(),
+		})
+	}
+	return records
+}
+
+// median 返回已排序切片的中位数
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// mean 返回平均值
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stddev 返回样本标准差
+func stddev(values []float64, center float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - center) * (v - center)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// ComputeLimits 根据某个产品的历史数据计算各 bin 的动态限值
+// 历史记录中未出现的 bin 按 0% 计入；mad 方法在 MAD 为 0 时改用标准差
+func ComputeLimits(history []HistoryRecord, product string, opts Options) map[string]Limit {
+	var records []HistoryRecord
+	codes := make(map[string]struct{})
+	for _, rec := range history {
+		if rec.Product != product {
+			continue
+		}
+		records = append(records, rec)
+		for code := range rec.Percents {
+			codes[code] = struct{}{}
+		}
+	}
+	if len(records) < opts.MinSamples {
+		return nil
+	}
+
+	limits := make(map[string]Limit, len(codes))
+	for code := range codes {
+		values := make([]float64, len(records))
+		for i, rec := range records {
+			values[i] = rec.Percents[code]
+		}
+
+		var center, spread float64
+		if opts.Method == "mad" {
+			sort.Float64s(values)
+			center = median(values)
+			deviations := make([]float64, len(values))
+			for i, v := range values {
+				deviations[i] = math.Abs(v - center)
+			}
+			sort.Float64s(deviations)
+			spread = 1.4826 * median(deviations) // 1.4826 使 MAD 在正态分布下与标准差一致
+			if spread == 0 {
+				// 半数以上样本相同时 MAD 为 0，限值会收缩到中位数上，改用标准差估计离散程度
+				spread = stddev(values, mean(values))
+			}
+		} else {
+			center = mean(values)
+			spread = stddev(values, center)
+		}
+
+		limits[code] = Limit{
+			Center:  center,
+			Lower:   math.Max(0, center-opts.K*spread),
+			Upper:   math.Min(100, center+opts.K*spread),
+			Samples: len(records),
+		}
+	}
+	return limits
+}
+
+// Apply 用动态限值检查本次结果，超限记录追加到 Alarms
+// 良品 bin 只检查下限，失效 bin 只检查上限；历史中从未出现的失效 bin 一律视为超限
+func Apply(results []model.FileResult, limits map[string]Limit, goodBins []string) {
+	if len(limits) == 0 {
+		return
+	}
+	for i := range results {
+		percents := results[i].BinPercents()
+		codes := make([]string, 0, len(percents))
+		for code := range percents {
+			codes = append(codes, code)
+		}
+		for code := range limits {
+			if _, ok := percents[code]; !ok {
+				codes = append(codes, code)
+			}
+		}
+		sort.Strings(codes)
+
+		for _, code := range codes {
+			p := percents[code]
+			limit := limits[code]
+			if model.IsGoodBin(code, goodBins) {
+				if p < limit.Lower {
+					results[i].Alarms = append(results[i].Alarms, model.Alarm{Bin: code, Kind: "SPC下限", Value: p, Limit: limit.Lower})
+				}
+			} else if p > limit.Upper {
+				results[i].Alarms = append(results[i].Alarms, model.Alarm{Bin: code, Kind: "SPC上限", Value: p, Limit: limit.Upper})
+			}
+		}
+	}
+}
+
+// Run 读取历史数据、检查本次结果并将其追加到历史中
+// 除非设置了 IncludeOutliers，本次超出动态限值的晶圆不写入历史
+func Run(results []model.FileResult, product string, opts Options, goodBins []string) error {
+	path, err := opts.HistoryPath()
+	if err != nil {
+		return err
+	}
+	history, err := LoadHistory(path)
+	if err != nil {
+		return err
+	}
+
+	alarmsBefore := make([]int, len(results))
+	for i, result := range results {
+		alarmsBefore[i] = len(result.Alarms)
+	}
+	Apply(results, ComputeLimits(history, product, opts), goodBins)
+
+	accepted := results
+	if !opts.IncludeOutliers {
+		accepted = make([]model.FileResult, 0, len(results))
+		for i, result := range results {
+			if len(result.Alarms) == alarmsBefore[i] {
+				accepted = append(accepted, result)
+			}
+		}
+	}
+	return AppendHistory(path, HistoryRecordsFor(accepted, product))
+}
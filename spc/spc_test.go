@@ -0,0 +1,165 @@
+package spc
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deviceParser/model"
+)
+
+// records 按给定的 005 占比生成 P1 产品的历史记录，每片晶圆其余为良品 001
+func records(percents ...float64) []HistoryRecord {
+	var history []HistoryRecord
+	for i, p := range percents {
+		history = append(history, HistoryRecord{
+			Product:  "P1",
+			Lot:      "L1",
+			Wafer:    string(rune('A' + i)),
+			Percents: map[string]float64{"001": 100 - p, "005": p},
+		})
+	}
+	return history
+}
+
+func TestComputeLimits(t *testing.T) {
+	// 其他产品的记录不参与计算
+	other := HistoryRecord{Product: "P2", Lot: "L9", Wafer: "01", Percents: map[string]float64{"005": 90, "099": 50}}
+
+	tests := []struct {
+		name    string
+		history []HistoryRecord
+		opts    Options
+		want    *Limit // nil 表示不计算限值
+	}{
+		{
+			// 均值 3，样本标准差 sqrt(2.5)
+			name:    "sigma",
+			history: append(records(1, 2, 3, 4, 5), other),
+			opts:    Options{Method: "sigma", K: 2, MinSamples: 5},
+			want:    &Limit{Center: 3, Lower: 0, Upper: 3 + 2*math.Sqrt(2.5), Samples: 5},
+		},
+		{
+			// 中位数 3，MAD 为 1，不受 100 这个异常值影响
+			name:    "mad",
+			history: records(1, 2, 3, 4, 100),
+			opts:    Options{Method: "mad", K: 3, MinSamples: 5},
+			want:    &Limit{Center: 3, Lower: 0, Upper: 3 + 3*1.4826, Samples: 5},
+		},
+		{
+			// MAD 为 0 时以中位数为中心、标准差为离散程度
+			name:    "zero mad",
+			history: records(2, 2, 2, 2, 10),
+			opts:    Options{Method: "mad", K: 1, MinSamples: 5},
+			want:    &Limit{Center: 2, Lower: 2 - math.Sqrt(12.8), Upper: 2 + math.Sqrt(12.8), Samples: 5},
+		},
+		{
+			name:    "fewer than min samples",
+			history: append(records(1, 2, 3, 4), other),
+			opts:    Options{Method: "sigma", K: 3, MinSamples: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := ComputeLimits(tt.history, "P1", tt.opts)
+			if tt.want == nil {
+				if limits != nil {
+					t.Errorf("limits = %+v, want nil", limits)
+				}
+				return
+			}
+			if _, ok := limits["099"]; ok {
+				t.Error("limits include a bin from another product")
+			}
+			got := limits["005"]
+			want := *tt.want
+			want.Lower = math.Max(0, want.Lower)
+			if got.Samples != want.Samples || !near(got.Center, want.Center) || !near(got.Lower, want.Lower) || !near(got.Upper, want.Upper) {
+				t.Errorf("limit = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestLoadHistoryDedupe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	content := strings.Join([]string{
+		`{"product":"P1","lot":"L1","wafer":"01","percents":{"005":1}}`,
+		`{"product":"P1","lot":"L1","wafer":"02","percents":{"005":2}}`,
+		`{"product":"P2","lot":"L1","wafer":"01","percents":{"005":3}}`,
+		``,
+		`{"product":"P1","lot":"L1","wafer":"01","percents":{"005":4}}`,
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一产品的同一晶圆以最后一次为准，位置保持首次出现的顺序；不同产品分别保留
+	want := []struct {
+		product, wafer string
+		percent        float64
+	}{{"P1", "01", 4}, {"P1", "02", 2}, {"P2", "01", 3}}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v", history)
+	}
+	for i, w := range want {
+		if h := history[i]; h.Product != w.product || h.Wafer != w.wafer || h.Percents["005"] != w.percent {
+			t.Errorf("record %d = %+v, want %+v", i, h, w)
+		}
+	}
+
+	if history, err := LoadHistory(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil || history != nil {
+		t.Errorf("missing file: %v, %v", history, err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHistory(path); err == nil {
+		t.Error("malformed line: expected error")
+	}
+}
+
+func TestRunExcludesOutliers(t *testing.T) {
+	for _, include := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		if err := AppendHistory(path, records(1, 2, 1, 2, 1, 2)); err != nil {
+			t.Fatal(err)
+		}
+		results := []model.FileResult{
+			{Lot: "L2", Wafer: "01", Counts: map[string]int{"001": 985, "005": 15}},
+			{Lot: "L2", Wafer: "02", Counts: map[string]int{"001": 600, "005": 400}},
+		}
+		opts := Options{Method: "sigma", K: 3, MinSamples: 5, HistoryFile: path, IncludeOutliers: include}
+		if err := Run(results, "P1", opts, nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(results[0].Alarms) != 0 || len(results[1].Alarms) == 0 {
+			t.Fatalf("alarms = %+v / %+v", results[0].Alarms, results[1].Alarms)
+		}
+
+		history, err := LoadHistory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantLen := 7
+		if include {
+			wantLen = 8
+		}
+		if len(history) != wantLen {
+			t.Errorf("includeOutliers=%v: history has %d records, want %d", include, len(history), wantLen)
+		}
+		if history[6].Lot != "L2" || history[6].Wafer != "01" {
+			t.Errorf("record 6 = %+v, want L2-01", history[6])
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package store 保存每次运行的晶圆计数结果，供历史查询与趋势分析使用
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"deviceParser/model"
+)
+
+// waferBucket 存放所有晶圆记录的 bucket
+// 键为 LOT \x00 WAFER \x00 运行时间 \x00 文件哈希前缀，同一 LOT 的记录相邻，便于按 LOT 前缀查询
+var waferBucket = []byte("wafers")
+
+// Store 本地结果数据库，使用纯 Go 的 bbolt 单文件存储
+type Store struct {
+	db *bolt.DB
+}
+
+// Wafer 数据库中的一条晶圆记录
+type Wafer struct {
+	RunTime    time.Time         `json:"runTime"`
+	Product    string            `json:"product,omitempty"`
+	Lot        string            `json:"lot"`
+	Wafer      string            `json:"wafer"`
+	FileName   string            `json:"fileName"`
+	SourceHash string            `json:"sourceHash"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Counts     map[string]int    `json:"counts"`
+}
+
+// Query 查询条件，零值字段表示不限制
+type Query struct {
+	Lot     string    // LOT 前缀
+	Product string    // 产品名，需完全一致
+	From    time.Time // 运行时间下限 (含)
+	To      time.Time // 运行时间上限 (不含)
+}
+
+// DefaultPath 返回默认数据库路径 (用户配置目录下)
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("无法定位用户配置目录: %w", err)
+	}
+	return filepath.Join(dir, "deviceParser", "results.db"), nil
+}
+
+// Open 打开 (或创建) 数据库文件
+func Open(filePath string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+	}
+	// 数据库文件同一时间只能被一个进程打开，等待 1 秒后放弃，避免界面卡死
+	db, err := bolt.Open(filePath, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(waferBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close 关闭数据库
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// waferKey 生成记录的键
+func waferKey(w Wafer) []byte {
+	hash := w.SourceHash
+	if len(hash) > 16 {
+		hash = hash[:16]
+	}
+	return []byte(strings.Join([]string{w.Lot, w.Wafer, w.RunTime.UTC().Format(time.RFC3339Nano), hash}, "\x00"))
+}
+
+// stored 判断数据库中是否已有同一 LOT、WAFER 且来自同一文件内容的记录
+func stored(bucket *bolt.Bucket, lot, wafer, hash string) (bool, error) {
+	c := bucket.Cursor()
+	prefix := []byte(lot + "\x00" + wafer + "\x00")
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var w Wafer
+		if err := json.Unmarshal(v, &w); err != nil {
+			return false, fmt.Errorf("记录 %q 已损坏: %w", k, err)
+		}
+		if w.SourceHash == hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Save 将一次运行的全部结果写入数据库
+// 重复处理同一文件时，LOT、WAFER 与文件哈希都已存在的记录会被跳过，避免历史查询重复计数
+func (s *Store) Save(results []model.FileResult, product string, runTime time.Time) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(waferBucket)
+		for _, result := range results {
+			if result.SourceHash != "" {
+				exists, err := stored(bucket, result.Lot, result.Wafer, result.SourceHash)
+				if err != nil {
+					return err
+				}
+				if exists {
+					continue
+				}
+			}
+			w := Wafer{
+				RunTime:    runTime,
+				Product:    product,
+				Lot:        result.Lot,
+				Wafer:      result.Wafer,
+				FileName:   result.FileName,
+				SourceHash: result.SourceHash,
+				Metadata:   result.Metadata,
+				Counts:     result.Counts,
+			}
+			value, err := json.Marshal(w)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(waferKey(w), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入数据库失败: %w", err)
+	}
+	return nil
+}
+
+// Query 按条件查询记录，结果按 LOT、WAFER、运行时间排序
+func (s *Store) Query(q Query) ([]Wafer, error) {
+	var wafers []Wafer
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(waferBucket).Cursor()
+		prefix := []byte(q.Lot)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var w Wafer
+			if err := json.Unmarshal(v, &w); err != nil {
+				return fmt.Errorf("记录 %q 已损坏: %w", k, err)
+			}
+			if q.Product != "" && w.Product != q.Product {
+				continue
+			}
+			if !q.From.IsZero() && w.RunTime.Before(q.From) {
+				continue
+			}
+			if !q.To.IsZero() && !w.RunTime.Before(q.To) {
+				continue
+			}
+			wafers = append(wafers, w)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询数据库失败: %w", err)
+	}
+	return wafers, nil
+}
+
+// ToFileResult 转换为报表使用的计数结果
+func (w Wafer) ToFileResult() model.FileResult {
+	return model.FileResult{
+		FileName:   w.FileName,
+		Lot:        w.Lot,
+		Wafer:      w.Wafer,
+		Counts:     w.Counts,
+		Metadata:   w.Metadata,
+		SourceHash: w.SourceHash,
+	}
+}
+
+// SaveResults 打开默认数据库 (或 dbPath 指定的数据库) 并保存本次结果
+func SaveResults(dbPath string, results []model.FileResult, product string) error {
+	if dbPath == "" {
+		var err error
+		if dbPath, err = DefaultPath(); err != nil {
+			return err
+		}
+	}
+	store, err := Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.Save(results, product, time.Now())
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"deviceParser/model"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "sub", "results.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testResult(lot, wafer, hash string) model.FileResult {
+	return model.FileResult{
+		FileName:   lot + "_" + wafer + ".txt",
+		Lot:        lot,
+		Wafer:      wafer,
+		Counts:     map[string]int{"001": 90, "012": 3},
+		Metadata:   map[string]string{"TEST_DATE": "2024-05-01"},
+		SourceHash: hash,
+	}
+}
+
+func TestSaveQuery(t *testing.T) {
+	s := openTestStore(t)
+	day1 := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	day3 := day1.AddDate(0, 0, 2)
+	saves := []struct {
+		results []model.FileResult
+		product string
+		runTime time.Time
+	}{
+		{[]model.FileResult{testResult("A100", "01", "h1"), testResult("A100", "02", "h2")}, "P1", day1},
+		{[]model.FileResult{testResult("A200", "01", "h3")}, "P2", day2},
+		{[]model.FileResult{testResult("B100", "01", "h4")}, "P1", day3},
+		// 重新处理同一文件：A100-01 已存在，A100-01 内容变化后 (h5) 作为新记录保存
+		{[]model.FileResult{testResult("A100", "01", "h1"), testResult("A100", "01", "h5")}, "P1", day3},
+	}
+	for _, sv := range saves {
+		if err := s.Save(sv.results, sv.product, sv.runTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string // 期望记录的 SourceHash，按 LOT、WAFER、运行时间排序
+	}{
+		{"all", Query{}, []string{"h1", "h5", "h2", "h3", "h4"}},
+		{"lot prefix", Query{Lot: "A1"}, []string{"h1", "h5", "h2"}},
+		{"lot exact", Query{Lot: "A200"}, []string{"h3"}},
+		{"product", Query{Product: "P1"}, []string{"h1", "h5", "h2", "h4"}},
+		{"from", Query{From: day2}, []string{"h5", "h3", "h4"}},
+		{"to exclusive", Query{To: day2}, []string{"h1", "h2"}},
+		{"range", Query{From: day2, To: day3}, []string{"h3"}},
+		{"combined", Query{Lot: "A", Product: "P1", From: day2}, []string{"h5"}},
+		{"no match", Query{Lot: "C"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wafers, err := s.Query(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, w := range wafers {
+				got = append(got, w.SourceHash)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToFileResult(t *testing.T) {
+	s := openTestStore(t)
+	result := testResult("A100", "01", "h1")
+	runTime := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	if err := s.Save([]model.FileResult{result}, "P1", runTime); err != nil {
+		t.Fatal(err)
+	}
+	wafers, err := s.Query(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wafers) != 1 {
+		t.Fatalf("got %d records, want 1", len(wafers))
+	}
+	w := wafers[0]
+	if w.Product != "P1" || !w.RunTime.Equal(runTime) {
+		t.Errorf("product = %q, runTime = %v", w.Product, w.RunTime)
+	}
+	if got := w.ToFileResult(); !reflect.DeepEqual(got, result) {
+		t.Errorf("ToFileResult = %+v, want %+v", got, result)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"deviceParser/mapping"
+	"deviceParser/mes"
+	"deviceParser/model"
+	"deviceParser/parser"
+	"deviceParser/report"
+	"deviceParser/spc"
+	"deviceParser/store"
+)
+
+// ledgerEntry 已处理文件台账中的一行，每片晶圆一行，Wafer 为空表示该文件没有数据
+type ledgerEntry struct {
+	Path        string       `json:"path"`
+	SourceHash  string       `json:"sourceHash"`
+	ProcessedAt time.Time    `json:"processedAt"`
+	Wafer       *store.Wafer `json:"wafer,omitempty"`
+}
+
+// folderWatcher 监视文件夹，自动处理新写入的 map 文件
+// 台账按文件内容哈希记录已处理的文件，重启后不会重复处理
+type folderWatcher struct {
+	Settings    *settings // 映射配置、重判规则及报表模板
+	Dirs        []string
+	OutDir      string
+	SummaryPath string
+	Title       string        // 滚动汇总的标题
+	Layout      report.Layout // 每片晶圆独立结果的版式
+	Settle      time.Duration // 文件在该时间内没有变化才视为写入完成
+	DBPath      string        // 本地数据库路径，为空时使用默认路径
+	SaveToStore bool
+
+	ledgerPath string
+	processed  map[string]bool    // 已处理文件的内容哈希
+	results    []model.FileResult // 滚动汇总中的全部结果
+	pending    map[string]pendingFile
+}
+
+// pendingFile 等待写入完成的文件
+type pendingFile struct {
+	lastEvent time.Time
+	size      int64
+}
+
+// loadLedger 读取台账，恢复已处理文件集合及滚动汇总
+func (w *folderWatcher) loadLedger() error {
+	w.processed = make(map[string]bool)
+	f, err := os.Open(w.ledgerPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取台账失败: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry ledgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("台账第 %d 行格式错误: %w", lineNum, err)
+		}
+		w.processed[entry.SourceHash] = true
+		if entry.Wafer != nil {
+			result := entry.Wafer.ToFileResult()
+			result.Alarms = mapping.EvaluateLimits(result, w.Settings.Profile.Limits(), w.Settings.Profile.GoodBins)
+			w.results = append(w.results, result)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取台账失败: %w", err)
+	}
+	return nil
+}
+
+// appendLedger 追加台账记录，同一文件的多条记录一次写入
+func (w *folderWatcher) appendLedger(entries ...ledgerEntry) error {
+	var buf []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("序列化台账失败: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	f, err := os.OpenFile(w.ledgerPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开台账失败: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("写入台账失败: %w", err)
+	}
+	return nil
+}
+
+// schedule 将文件加入等待队列，重复事件会推迟其处理时间
+func (w *folderWatcher) schedule(path string) {
+	p := w.pending[path]
+	p.lastEvent = time.Now()
+	w.pending[path] = p
+}
+
+// checkPending 处理已经静默超过 Settle 且大小不再变化的文件
+func (w *folderWatcher) checkPending() {
+	now := time.Now()
+	for path, p := range w.pending {
+		if now.Sub(p.lastEvent) < w.Settle {
+			continue
+		}
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path) // 文件已被删除或移走
+			continue
+		}
+		if fileInfo.Size() != p.size {
+			// 大小仍在变化，等待下一个静默周期
+			w.pending[path] = pendingFile{lastEvent: now, size: fileInfo.Size()}
+			continue
+		}
+		delete(w.pending, path)
+		if err := w.process(path); err != nil {
+			log.Printf("处理 %s 失败: %v", path, err)
+		}
+	}
+}
+
+// process 处理单个文件，压缩包展开为其中的 .txt 文件逐个处理，包内已处理过的文件按哈希跳过
+func (w *folderWatcher) process(path string) error {
+	if !parser.IsArchive(path) {
+		return w.processFile(path, nil)
+	}
+	archives := parser.NewArchives()
+	defer archives.Close()
+	files, failed, err := parser.CollectFiles([]string{path}, archives)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return errors.New(failed[0].Detail)
+	}
+	var errs []error
+	for _, file := range files {
+		if err := w.processFile(file, archives); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", parser.SourceName(file), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// processFile 处理单个 map 文件：写入台账、输出每片晶圆的独立结果并更新滚动汇总
+// 多晶圆文件中的每片晶圆各占台账一行，这些行共用文件的哈希
+func (w *folderWatcher) processFile(path string, archives *parser.Archives) error {
+	parserOpts := w.Settings.Profile.ParserOptions()
+	parserOpts.Archives = archives
+	scan, err := parser.ScanFile(path, parserOpts)
+	if err != nil {
+		return err
+	}
+	if err := scan.Err(); err != nil && !errors.Is(err, model.ErrNoData) {
+		return err
+	}
+	if w.processed[scan.SourceHash] {
+		return nil
+	}
+	if warning := scan.Warning(); warning != nil {
+		log.Printf("%s: %v，已保留结果", path, warning)
+	}
+
+	processedAt := time.Now()
+	if !scan.HasData() {
+		log.Printf("%s 中没有数据，已跳过", path)
+		w.processed[scan.SourceHash] = true
+		return w.appendLedger(ledgerEntry{Path: path, SourceHash: scan.SourceHash, ProcessedAt: processedAt})
+	}
+
+	batch := make([]model.FileResult, len(scan.Results))
+	for i, result := range scan.Results {
+		batch[i] = mapping.RebinCounts(w.Settings.Rules, result)
+	}
+	mapping.ApplyLimits(batch, w.Settings.Profile.Limits(), w.Settings.Profile.GoodBins)
+	if w.Settings.Profile.SPC != nil {
+		if err := spc.Run(batch, w.Settings.Profile.Product, *w.Settings.Profile.SPC, w.Settings.Profile.GoodBins); err != nil {
+			return fmt.Errorf("SPC 检查失败: %w", err)
+		}
+	}
+
+	// 先写台账并并入滚动汇总：之后的输出步骤即使失败，下一个写入事件也不会重复处理该文件，
+	// 避免滚动汇总重复计入、重复上传 MES
+	entries := make([]ledgerEntry, 0, len(batch))
+	for _, result := range batch {
+		entries = append(entries, ledgerEntry{Path: path, SourceHash: scan.SourceHash, ProcessedAt: processedAt, Wafer: &store.Wafer{
+			RunTime:    processedAt,
+			Product:    w.Settings.Profile.Product,
+			Lot:        result.Lot,
+			Wafer:      result.Wafer,
+			FileName:   result.FileName,
+			SourceHash: result.SourceHash,
+			Metadata:   result.Metadata,
+			Counts:     result.Counts,
+		}})
+	}
+	if err := w.appendLedger(entries...); err != nil {
+		return err
+	}
+	w.processed[scan.SourceHash] = true
+	w.results = append(w.results, batch...)
+
+	// 报表写入失败时记录错误并继续上传 MES、保存数据库，滚动汇总在下次更新时补全
+	var errs []error
+	for _, result := range batch {
+		outFilePath := filepath.Join(w.OutDir, fmt.Sprintf("%s_result.xlsx", report.FileNameStem(result.FileName, result.Block)))
+		if err := w.Settings.writeWafer(outFilePath, result, w.Layout); err != nil {
+			errs = append(errs, fmt.Errorf("写入结果失败: %w", err))
+		}
+	}
+	if err := w.Settings.writeSummary(w.SummaryPath, w.Title, w.results, nil); err != nil {
+		errs = append(errs, fmt.Errorf("更新汇总失败: %w", err))
+	}
+
+	if w.Settings.Profile.MES != nil {
+		mesReport, err := mes.Push(batch, w.Settings.Profile.Product, *w.Settings.Profile.MES, w.Settings.Profile.GoodBins)
+		if err != nil {
+			log.Printf("上传到 MES 失败: %v", err)
+		} else if mesReport.Queued > 0 || mesReport.Rejected > 0 {
+			log.Printf("上传到 MES 失败: %s", strings.TrimPrefix(mesReport.Note(), "\n"))
+		}
+	}
+
+	if w.SaveToStore {
+		if err := store.SaveResults(w.DBPath, batch, w.Settings.Profile.Product); err != nil {
+			log.Printf("保存到数据库失败: %v", err)
+		}
+	}
+
+	for _, result := range batch {
+		log.Printf("已处理 %s (%s-%s)，汇总共 %d 片晶圆", path, result.Lot, result.Wafer, len(w.results))
+		for _, a := range result.Alarms {
+			log.Printf("  超限: %s", a)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run 开始监视，直到 ctx 被取消
+func (w *folderWatcher) run(ctx context.Context) error {
+	if err := os.MkdirAll(w.OutDir, 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	w.ledgerPath = filepath.Join(w.OutDir, "processed_ledger.jsonl")
+	w.pending = make(map[string]pendingFile)
+	if err := w.loadLedger(); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建文件监视失败: %w", err)
+	}
+	defer watcher.Close()
+
+	for _, dir := range w.Dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("无法监视 %s: %w", dir, err)
+		}
+		// 启动时补处理监视目录中已存在但尚未处理的文件
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("读取文件夹失败: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && (parser.IsMapFile(entry.Name()) || parser.IsArchive(entry.Name())) {
+				w.schedule(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	log.Printf("正在监视 %s，已处理 %d 个文件，按 Ctrl+C 退出", strings.Join(w.Dirs, ", "), len(w.processed))
+
+	ticker := time.NewTicker(w.Settle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if (parser.IsMapFile(event.Name) || parser.IsArchive(event.Name)) && event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				w.schedule(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("文件监视出错: %v", err)
+		case <-ticker.C:
+			w.checkPending()
+		}
+	}
+}
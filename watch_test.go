@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"deviceParser/report"
+)
+
+// newTestWatcher 返回输出到临时目录的监视器，与 run 中的初始化一致但不启动文件监视
+func newTestWatcher(t *testing.T, outDir string) *folderWatcher {
+	t.Helper()
+	w := &folderWatcher{
+		Settings:    newSettings(),
+		OutDir:      outDir,
+		SummaryPath: filepath.Join(outDir, "summary.xlsx"),
+		Title:       "监视汇总",
+		Layout:      report.LayoutTable,
+		Settle:      time.Second,
+		ledgerPath:  filepath.Join(outDir, "processed_ledger.jsonl"),
+		pending:     make(map[string]pendingFile),
+	}
+	if err := w.loadLedger(); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// copyMap 将 testdata 中的 map 文件复制到 dir 下的 name
+func copyMap(t *testing.T, src, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "maps", src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readLedger(t *testing.T, w *folderWatcher) []byte {
+	t.Helper()
+	data, err := os.ReadFile(w.ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWatcherProcessFile(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, outDir)
+
+	multi := copyMap(t, "multi_wafer.txt", inDir, "multi.txt")
+	if err := w.processFile(multi, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.results) != 2 {
+		t.Fatalf("results = %d, want 2", len(w.results))
+	}
+	// 多晶圆文件每片晶圆一行台账
+	if lines := bytes.Count(readLedger(t, w), []byte("\n")); lines != 2 {
+		t.Errorf("ledger lines = %d, want 2", lines)
+	}
+	for _, name := range []string{"multi_1_result.xlsx", "multi_2_result.xlsx", "summary.xlsx"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("missing output: %v", err)
+		}
+	}
+
+	// 内容相同的文件 (即使路径不同) 按哈希跳过
+	ledger := readLedger(t, w)
+	copied := copyMap(t, "multi_wafer.txt", inDir, "multi_copy.txt")
+	for _, path := range []string{multi, copied} {
+		if err := w.processFile(path, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.results) != 2 {
+		t.Errorf("results = %d after reprocessing, want 2", len(w.results))
+	}
+	if !bytes.Equal(readLedger(t, w), ledger) {
+		t.Error("ledger changed after reprocessing")
+	}
+
+	// 没有数据的文件也记入台账，之后不再处理
+	empty := filepath.Join(inDir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("LOT: A1\nWAFER: 01\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.processFile(empty, nil); err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(readLedger(t, w), []byte("\n")); lines != 3 {
+		t.Errorf("ledger lines = %d, want 3", lines)
+	}
+	if len(w.results) != 2 {
+		t.Errorf("results = %d, want 2", len(w.results))
+	}
+}
+
+func TestWatcherLoadLedger(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, outDir)
+	basic := copyMap(t, "basic.txt", inDir, "basic.txt")
+	multi := copyMap(t, "multi_wafer.txt", inDir, "multi.txt")
+	for _, path := range []string{basic, multi} {
+		if err := w.processFile(path, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ledger := readLedger(t, w)
+
+	// 重启后从台账恢复已处理集合与滚动汇总，已处理的文件不再重复处理
+	restarted := newTestWatcher(t, outDir)
+	if len(restarted.processed) != 2 {
+		t.Errorf("processed = %d, want 2", len(restarted.processed))
+	}
+	if len(restarted.results) != len(w.results) {
+		t.Fatalf("results = %d, want %d", len(restarted.results), len(w.results))
+	}
+	for i, result := range restarted.results {
+		if result.Lot != w.results[i].Lot || result.Wafer != w.results[i].Wafer || result.TotalDies() != w.results[i].TotalDies() {
+			t.Errorf("result %d = %s-%s, want %s-%s", i, result.Lot, result.Wafer, w.results[i].Lot, w.results[i].Wafer)
+		}
+	}
+	if err := restarted.processFile(basic, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readLedger(t, restarted), ledger) {
+		t.Error("ledger changed after restart")
+	}
+
+	// 台账损坏时报错，而不是当作空台账重新处理全部文件
+	if err := os.WriteFile(w.ledgerPath, append(ledger, "{broken\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&folderWatcher{Settings: newSettings(), ledgerPath: w.ledgerPath}).loadLedger(); err == nil {
+		t.Error("expected error for corrupt ledger")
+	}
+}
+
+func TestWatcherCheckPending(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	w := newTestWatcher(t, outDir)
+	path := copyMap(t, "basic.txt", inDir, "basic.txt")
+	gone := filepath.Join(inDir, "gone.txt")
+
+	w.schedule(path)
+	w.schedule(gone)
+	// 尚未静默 Settle，不处理
+	w.checkPending()
+	if len(w.pending) != 2 || len(w.results) != 0 {
+		t.Fatalf("pending = %d, results = %d before settle", len(w.pending), len(w.results))
+	}
+
+	settle := func() {
+		for p, pf := range w.pending {
+			pf.lastEvent = time.Now().Add(-2 * w.Settle)
+			w.pending[p] = pf
+		}
+	}
+	// 静默后第一次检查记下文件大小 (与入队时不同)，已删除的文件移出队列
+	settle()
+	w.checkPending()
+	if _, ok := w.pending[gone]; ok {
+		t.Error("deleted file still pending")
+	}
+	if _, ok := w.pending[path]; !ok || len(w.results) != 0 {
+		t.Fatal("file processed before its size was confirmed")
+	}
+
+	// 大小仍在变化，继续等待
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\n")
+	f.Close()
+	settle()
+	w.checkPending()
+	if _, ok := w.pending[path]; !ok || len(w.results) != 0 {
+		t.Fatal("file processed while still growing")
+	}
+
+	// 大小稳定后处理
+	settle()
+	w.checkPending()
+	if len(w.pending) != 0 || len(w.results) != 1 {
+		t.Errorf("pending = %d, results = %d after settle", len(w.pending), len(w.results))
+	}
+}